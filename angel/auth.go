@@ -1,65 +1,46 @@
 package angel
 
 import (
-    "bytes"
-    "encoding/json"
+    "context"
     "fmt"
-    "net/http"
     "os"
+    "strconv"
+    "time"
 )
 
-type LoginResponse struct {
-    Status  bool   `json:"status"`
-    Message string `json:"message"`
-    Data    struct {
-        JwtToken  string `json:"jwtToken"`
-        FeedToken string `json:"feedToken"`
-    } `json:"data"`
-}
+const (
+    loginPath          = "/rest/auth/angelbroking/user/v1/loginByPassword"
+    generateTokensPath = "/rest/auth/angelbroking/jwt/v1/generateTokens"
+)
 
-func Authenticate() (string, string, error) {
-    url := "https://apiconnect.angelbroking.com/rest/auth/angelbroking/user/v1/loginByPassword"
-    
-    payload := map[string]string{
-        "clientcode": os.Getenv("ANGEL_CLIENT_ID"),
-        "password":   os.Getenv("ANGEL_CLIENT_PIN"),
-        "totp":      os.Getenv("ANGEL_TOTP_CODE"),
-    }
-    
-    jsonData, err := json.Marshal(payload)
+// Authenticate logs in against the SmartAPI REST endpoints at baseURL and
+// returns the JWT and feed tokens
+func Authenticate(baseURL string) (string, string, error) {
+    tokens, err := NewClient(baseURL, DefaultRequestTimeout).Login(context.Background())
     if err != nil {
-        return "", "", fmt.Errorf("failed to marshal payload: %v", err)
+        return "", "", fmt.Errorf("authentication failed: %w", err)
     }
+    return tokens.JwtToken, tokens.FeedToken, nil
+}
 
-    req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-    if err != nil {
-        return "", "", fmt.Errorf("failed to create request: %v", err)
+// totpCode generates a fresh code from ANGEL_TOTP_SECRET for every login
+// attempt, falling back to a static ANGEL_TOTP_CODE when no secret is set
+func totpCode() (string, error) {
+    secret := os.Getenv("ANGEL_TOTP_SECRET")
+    if secret == "" {
+        return os.Getenv("ANGEL_TOTP_CODE"), nil
     }
 
-    req.Header.Set("Content-Type", "application/json")
-    req.Header.Set("Accept", "application/json")
-    req.Header.Set("X-UserType", "USER")
-    req.Header.Set("X-SourceID", "WEB")
-    req.Header.Set("X-ClientLocalIP", os.Getenv("ANGEL_CLIENT_LOCAL_IP"))
-    req.Header.Set("X-ClientPublicIP", os.Getenv("ANGEL_CLIENT_PUBLIC_IP"))
-    req.Header.Set("X-MACAddress", os.Getenv("ANGEL_MAC_ADDRESS"))
-    req.Header.Set("X-PrivateKey", os.Getenv("ANGEL_API_KEY"))
-
-    client := &http.Client{}
-    resp, err := client.Do(req)
+    totp, err := NewTOTP(secret)
     if err != nil {
-        return "", "", fmt.Errorf("failed to send request: %v", err)
+        return "", fmt.Errorf("failed to load ANGEL_TOTP_SECRET: %v", err)
     }
-    defer resp.Body.Close()
-
-    var loginResp LoginResponse
-    if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-        return "", "", fmt.Errorf("failed to decode response: %v", err)
+    if skew := os.Getenv("ANGEL_TOTP_SKEW_SECS"); skew != "" {
+        secs, err := strconv.Atoi(skew)
+        if err != nil {
+            return "", fmt.Errorf("invalid ANGEL_TOTP_SKEW_SECS %q: %v", skew, err)
+        }
+        totp.Skew = time.Duration(secs) * time.Second
     }
-
-    if !loginResp.Status {
-        return "", "", fmt.Errorf("authentication failed: %s", loginResp.Message)
-    }
-
-    return loginResp.Data.JwtToken, loginResp.Data.FeedToken, nil
+    return totp.Generate(), nil
 }
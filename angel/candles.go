@@ -0,0 +1,171 @@
+package angel
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+// Candle intervals accepted by getCandleData
+const (
+    IntervalOneMinute     = "ONE_MINUTE"
+    IntervalThreeMinute   = "THREE_MINUTE"
+    IntervalFiveMinute    = "FIVE_MINUTE"
+    IntervalTenMinute     = "TEN_MINUTE"
+    IntervalFifteenMinute = "FIFTEEN_MINUTE"
+    IntervalThirtyMinute  = "THIRTY_MINUTE"
+    IntervalOneHour       = "ONE_HOUR"
+    IntervalOneDay        = "ONE_DAY"
+)
+
+// CandleIntervals maps each interval to its candle duration
+var CandleIntervals = map[string]time.Duration{
+    IntervalOneMinute:     time.Minute,
+    IntervalThreeMinute:   3 * time.Minute,
+    IntervalFiveMinute:    5 * time.Minute,
+    IntervalTenMinute:     10 * time.Minute,
+    IntervalFifteenMinute: 15 * time.Minute,
+    IntervalThirtyMinute:  30 * time.Minute,
+    IntervalOneHour:       time.Hour,
+    IntervalOneDay:        24 * time.Hour,
+}
+
+// maxCandleRangeDays is the longest range one getCandleData request may span
+var maxCandleRangeDays = map[string]int{
+    IntervalOneMinute:     30,
+    IntervalThreeMinute:   60,
+    IntervalFiveMinute:    100,
+    IntervalTenMinute:     100,
+    IntervalFifteenMinute: 200,
+    IntervalThirtyMinute:  200,
+    IntervalOneHour:       400,
+    IntervalOneDay:        2000,
+}
+
+// candleTimeLayout is the format of fromdate and todate, in exchange time
+const candleTimeLayout = "2006-01-02 15:04"
+
+// IST is the exchange time zone used by the historical API
+var IST = time.FixedZone("IST", 5*3600+1800)
+
+// Candle is one OHLCV bar
+type Candle struct {
+    Timestamp time.Time
+    Open      float64
+    High      float64
+    Low       float64
+    Close     float64
+    Volume    int64
+}
+
+// CandleRequest selects candles of one instrument. Exchange is a scrip-master
+// segment such as NSE or NFO.
+type CandleRequest struct {
+    Exchange string
+    Token    string
+    Interval string
+    From     time.Time
+    To       time.Time
+}
+
+// Candles fetches the candles for req, splitting ranges longer than the
+// interval allows into consecutive requests. Each request starts where the
+// previous one ended, as req.From need not fall on a candle boundary, and a
+// candle returned by both is kept once.
+func (c *Client) Candles(ctx context.Context, jwtToken string, req CandleRequest) ([]Candle, error) {
+    maxDays, ok := maxCandleRangeDays[req.Interval]
+    if !ok {
+        return nil, fmt.Errorf("unknown candle interval %q", req.Interval)
+    }
+    if req.To.Before(req.From) {
+        return nil, fmt.Errorf("candle range ends before it starts")
+    }
+
+    var candles []Candle
+    for from := req.From; ; {
+        to := from.AddDate(0, 0, maxDays)
+        if to.After(req.To) {
+            to = req.To
+        }
+
+        chunk := req
+        chunk.From, chunk.To = from, to
+        batch, err := c.CandleData(ctx, jwtToken, chunk)
+        if err != nil {
+            return nil, err
+        }
+        for _, candle := range batch {
+            if n := len(candles); n > 0 && !candle.Timestamp.After(candles[n-1].Timestamp) {
+                continue
+            }
+            candles = append(candles, candle)
+        }
+
+        if !to.Before(req.To) {
+            return candles, nil
+        }
+        from = to
+    }
+}
+
+// CandleData performs a single getCandleData request
+func (c *Client) CandleData(ctx context.Context, jwtToken string, req CandleRequest) ([]Candle, error) {
+    if maxDays, ok := maxCandleRangeDays[req.Interval]; !ok {
+        return nil, fmt.Errorf("unknown candle interval %q", req.Interval)
+    } else if req.To.Sub(req.From) > time.Duration(maxDays)*24*time.Hour {
+        return nil, fmt.Errorf("%s candles are limited to %d days per request", req.Interval, maxDays)
+    }
+
+    payload := map[string]string{
+        "exchange":    req.Exchange,
+        "symboltoken": req.Token,
+        "interval":    req.Interval,
+        "fromdate":    req.From.In(IST).Format(candleTimeLayout),
+        "todate":      req.To.In(IST).Format(candleTimeLayout),
+    }
+
+    var rows [][]json.RawMessage
+    if err := c.Do(ctx, http.MethodPost, candleDataPath, jwtToken, payload, &rows); err != nil {
+        return nil, err
+    }
+
+    candles := make([]Candle, 0, len(rows))
+    for _, row := range rows {
+        candle, err := parseCandle(row)
+        if err != nil {
+            return nil, err
+        }
+        candles = append(candles, candle)
+    }
+    return candles, nil
+}
+
+// parseCandle decodes a [timestamp, open, high, low, close, volume] row
+func parseCandle(row []json.RawMessage) (Candle, error) {
+    var candle Candle
+    if len(row) < 6 {
+        return candle, fmt.Errorf("candle row has %d fields, want 6", len(row))
+    }
+
+    var timestamp string
+    if err := json.Unmarshal(row[0], &timestamp); err != nil {
+        return candle, fmt.Errorf("invalid candle timestamp %s: %v", row[0], err)
+    }
+    parsed, err := time.Parse(time.RFC3339, timestamp)
+    if err != nil {
+        return candle, fmt.Errorf("invalid candle timestamp %q: %v", timestamp, err)
+    }
+    candle.Timestamp = parsed
+
+    var volume float64
+    for i, field := range []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close, &volume} {
+        if err := json.Unmarshal(row[i+1], field); err != nil {
+            return candle, fmt.Errorf("invalid candle field %s: %v", row[i+1], err)
+        }
+    }
+    candle.Volume = int64(volume)
+
+    return candle, nil
+}
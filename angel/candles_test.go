@@ -0,0 +1,130 @@
+package angel
+
+import (
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestCandlesSplitsLongRanges(t *testing.T) {
+    var requests []map[string]string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body map[string]string
+        json.NewDecoder(r.Body).Decode(&body)
+        requests = append(requests, body)
+
+        from, _ := time.ParseInLocation(candleTimeLayout, body["fromdate"], IST)
+        row := []interface{}{from.Format(time.RFC3339), 100.5, 101, 99.5, 100.25, 1200}
+        json.NewEncoder(w).Encode(map[string]interface{}{"status": true, "data": [][]interface{}{row}})
+    }))
+    defer server.Close()
+
+    client := NewClient(server.URL, time.Second)
+    client.limiters[candleDataPath] = newRateLimiter(1000)
+
+    from := time.Date(2025, 1, 1, 9, 15, 0, 0, IST)
+    candles, err := client.Candles(context.Background(), "jwt", CandleRequest{
+        Exchange: "NSE",
+        Token:    "2885",
+        Interval: IntervalOneMinute,
+        From:     from,
+        To:       from.AddDate(0, 0, 65),
+    })
+    if err != nil {
+        t.Fatalf("Candles: %v", err)
+    }
+
+    // 65 days of one minute candles need three requests of at most 30 days
+    want := []struct{ from, to string }{
+        {"2025-01-01 09:15", "2025-01-31 09:15"},
+        {"2025-01-31 09:15", "2025-03-02 09:15"},
+        {"2025-03-02 09:15", "2025-03-07 09:15"},
+    }
+    if len(requests) != len(want) {
+        t.Fatalf("got %d requests, want %d: %v", len(requests), len(want), requests)
+    }
+    for i, w := range want {
+        if requests[i]["fromdate"] != w.from || requests[i]["todate"] != w.to {
+            t.Errorf("request %d covers %s to %s, want %s to %s", i, requests[i]["fromdate"], requests[i]["todate"], w.from, w.to)
+        }
+        if requests[i]["exchange"] != "NSE" || requests[i]["symboltoken"] != "2885" || requests[i]["interval"] != IntervalOneMinute {
+            t.Errorf("request %d has %v", i, requests[i])
+        }
+    }
+
+    if len(candles) != 3 {
+        t.Fatalf("got %d candles, want 3", len(candles))
+    }
+    got := candles[0]
+    if !got.Timestamp.Equal(from) || got.Open != 100.5 || got.High != 101 || got.Low != 99.5 || got.Close != 100.25 || got.Volume != 1200 {
+        t.Errorf("got %+v", got)
+    }
+}
+
+func TestCandlesKeepsChunkBoundaryCandles(t *testing.T) {
+    // The stand-in returns the five minute candles of the morning of
+    // 2025-04-11 that start within each request's range
+    day := time.Date(2025, 4, 11, 9, 15, 0, 0, IST)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var body map[string]string
+        json.NewDecoder(r.Body).Decode(&body)
+        from, _ := time.ParseInLocation(candleTimeLayout, body["fromdate"], IST)
+        to, _ := time.ParseInLocation(candleTimeLayout, body["todate"], IST)
+
+        rows := [][]interface{}{}
+        for start := day; !start.After(day.Add(25 * time.Minute)); start = start.Add(5 * time.Minute) {
+            if !start.Before(from) && !start.After(to) {
+                rows = append(rows, []interface{}{start.Format(time.RFC3339), 100, 101, 99, 100.5, 500})
+            }
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{"status": true, "data": rows})
+    }))
+    defer server.Close()
+
+    client := NewClient(server.URL, time.Second)
+    client.limiters[candleDataPath] = newRateLimiter(1000)
+
+    // 100 days is the five minute limit, so each range splits on the morning
+    // of 2025-04-11: off a candle boundary at 09:17, on one at 09:15
+    for _, from := range []time.Time{
+        time.Date(2025, 1, 1, 9, 17, 0, 0, IST),
+        time.Date(2025, 1, 1, 9, 15, 0, 0, IST),
+    } {
+        candles, err := client.Candles(context.Background(), "jwt", CandleRequest{
+            Exchange: "NSE",
+            Token:    "2885",
+            Interval: IntervalFiveMinute,
+            From:     from,
+            To:       day.Add(25 * time.Minute),
+        })
+        if err != nil {
+            t.Fatalf("from %s: Candles: %v", from.Format(candleTimeLayout), err)
+        }
+
+        var got []string
+        for _, candle := range candles {
+            got = append(got, candle.Timestamp.In(IST).Format("15:04"))
+        }
+        want := []string{"09:15", "09:20", "09:25", "09:30", "09:35", "09:40"}
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("from %s: got candles %v, want %v", from.Format(candleTimeLayout), got, want)
+        }
+    }
+}
+
+func TestCandleDataRejectsOversizedRange(t *testing.T) {
+    client := NewClient("http://127.0.0.1:1", time.Second)
+    from := time.Date(2025, 1, 1, 9, 15, 0, 0, IST)
+    _, err := client.CandleData(context.Background(), "jwt", CandleRequest{
+        Interval: IntervalOneMinute,
+        From:     from,
+        To:       from.AddDate(0, 0, 31),
+    })
+    if err == nil {
+        t.Fatal("expected an error for a 31 day ONE_MINUTE range")
+    }
+}
@@ -0,0 +1,266 @@
+package angel
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    DefaultRequestTimeout = 10 * time.Second
+
+    profilePath    = "/rest/secure/angelbroking/user/v1/getProfile"
+    candleDataPath = "/rest/secure/angelbroking/historical/v1/getCandleData"
+
+    // maxLoggedBody caps how much of a response body is logged
+    maxLoggedBody = 512
+)
+
+// Response is the envelope of every SmartAPI REST response
+type Response struct {
+    Status    bool            `json:"status"`
+    Message   string          `json:"message"`
+    ErrorCode string          `json:"errorcode"`
+    Data      json.RawMessage `json:"data"`
+}
+
+// Tokens is the data of a login or generate-tokens response
+type Tokens struct {
+    JwtToken     string `json:"jwtToken"`
+    RefreshToken string `json:"refreshToken"`
+    FeedToken    string `json:"feedToken"`
+}
+
+// Profile is the data of a getProfile response
+type Profile struct {
+    ClientCode string   `json:"clientcode"`
+    Name       string   `json:"name"`
+    Exchanges  []string `json:"exchanges"`
+    Products   []string `json:"products"`
+}
+
+// Client calls the SmartAPI REST endpoints. Requests are rate limited per
+// endpoint and failures are returned as *APIError.
+type Client struct {
+    baseURL    string
+    HTTPClient *http.Client
+
+    // Debug logs every request and response with credentials redacted
+    Debug bool
+
+    limitersMu sync.Mutex
+    limiters   map[string]*rateLimiter
+}
+
+func NewClient(baseURL string, timeout time.Duration) *Client {
+    if timeout <= 0 {
+        timeout = DefaultRequestTimeout
+    }
+    return &Client{
+        baseURL:    strings.TrimRight(baseURL, "/"),
+        HTTPClient: &http.Client{Timeout: timeout},
+        limiters:   make(map[string]*rateLimiter),
+    }
+}
+
+// Login performs a password and TOTP login
+func (c *Client) Login(ctx context.Context) (*Tokens, error) {
+    totp, err := totpCode()
+    if err != nil {
+        return nil, err
+    }
+
+    payload := map[string]string{
+        "clientcode": os.Getenv("ANGEL_CLIENT_ID"),
+        "password":   os.Getenv("ANGEL_CLIENT_PIN"),
+        "totp":       totp,
+    }
+
+    var tokens Tokens
+    if err := c.Do(ctx, http.MethodPost, loginPath, "", payload, &tokens); err != nil {
+        return nil, err
+    }
+    return &tokens, nil
+}
+
+// GenerateTokens exchanges a refresh token for a new set of tokens
+func (c *Client) GenerateTokens(ctx context.Context, jwtToken, refreshToken string) (*Tokens, error) {
+    payload := map[string]string{
+        "refreshToken": refreshToken,
+    }
+
+    var tokens Tokens
+    if err := c.Do(ctx, http.MethodPost, generateTokensPath, jwtToken, payload, &tokens); err != nil {
+        return nil, err
+    }
+    return &tokens, nil
+}
+
+// Profile returns the profile of the logged in client
+func (c *Client) Profile(ctx context.Context, jwtToken string) (*Profile, error) {
+    var profile Profile
+    if err := c.Do(ctx, http.MethodGet, profilePath, jwtToken, nil, &profile); err != nil {
+        return nil, err
+    }
+    return &profile, nil
+}
+
+// Do sends a request to path and decodes the data field of the response
+// into out. jwtToken is sent as a bearer token when not empty.
+func (c *Client) Do(ctx context.Context, method, path, jwtToken string, payload, out interface{}) error {
+    if err := c.limiter(path).Wait(ctx); err != nil {
+        return err
+    }
+
+    var body io.Reader
+    var jsonData []byte
+    if payload != nil {
+        var err error
+        jsonData, err = json.Marshal(payload)
+        if err != nil {
+            return fmt.Errorf("failed to marshal payload: %v", err)
+        }
+        body = bytes.NewReader(jsonData)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+    if err != nil {
+        return fmt.Errorf("failed to create request: %v", err)
+    }
+
+    setHeaders(req)
+    if jwtToken != "" {
+        req.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(jwtToken, "Bearer "))
+    }
+
+    if c.Debug {
+        log.Printf("SmartAPI request %s %s %s", method, path, redactJSON(jsonData))
+    }
+
+    start := time.Now()
+    resp, err := c.HTTPClient.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to send request: %v", err)
+    }
+    defer resp.Body.Close()
+
+    respData, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return fmt.Errorf("failed to read response: %v", err)
+    }
+
+    if c.Debug {
+        logged := redactJSON(respData)
+        if len(logged) > maxLoggedBody {
+            logged = logged[:maxLoggedBody] + "..."
+        }
+        log.Printf("SmartAPI response %s %s %d in %v %s", method, path, resp.StatusCode, time.Since(start).Round(time.Millisecond), logged)
+    }
+
+    var apiResp Response
+    decodeErr := json.Unmarshal(respData, &apiResp)
+
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        apiErr := &APIError{Endpoint: path, HTTPStatus: resp.StatusCode, ErrorCode: apiResp.ErrorCode, Message: apiResp.Message}
+        if apiErr.Message == "" {
+            apiErr.Message = http.StatusText(resp.StatusCode)
+        }
+        return apiErr
+    }
+    if decodeErr != nil {
+        return fmt.Errorf("failed to decode response: %v", decodeErr)
+    }
+    if !apiResp.Status {
+        return &APIError{Endpoint: path, HTTPStatus: resp.StatusCode, ErrorCode: apiResp.ErrorCode, Message: apiResp.Message}
+    }
+
+    if out != nil && len(apiResp.Data) > 0 && string(apiResp.Data) != "null" {
+        if err := json.Unmarshal(apiResp.Data, out); err != nil {
+            return fmt.Errorf("failed to decode response data: %v", err)
+        }
+    }
+    return nil
+}
+
+func (c *Client) limiter(path string) *rateLimiter {
+    c.limitersMu.Lock()
+    defer c.limitersMu.Unlock()
+
+    limiter, ok := c.limiters[path]
+    if !ok {
+        limit, ok := endpointRateLimits[path]
+        if !ok {
+            limit = defaultRateLimit
+        }
+        limiter = newRateLimiter(limit)
+        c.limiters[path] = limiter
+    }
+    return limiter
+}
+
+// setHeaders adds the headers SmartAPI expects on every REST request
+func setHeaders(req *http.Request) {
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Accept", "application/json")
+    req.Header.Set("X-UserType", "USER")
+    req.Header.Set("X-SourceID", "WEB")
+    req.Header.Set("X-ClientLocalIP", os.Getenv("ANGEL_CLIENT_LOCAL_IP"))
+    req.Header.Set("X-ClientPublicIP", os.Getenv("ANGEL_CLIENT_PUBLIC_IP"))
+    req.Header.Set("X-MACAddress", os.Getenv("ANGEL_MAC_ADDRESS"))
+    req.Header.Set("X-PrivateKey", os.Getenv("ANGEL_API_KEY"))
+}
+
+// Keys whose values are replaced in logged request and response bodies
+var secretKeys = map[string]bool{
+    "password":     true,
+    "totp":         true,
+    "jwttoken":     true,
+    "refreshtoken": true,
+    "feedtoken":    true,
+    "clientcode":   true,
+}
+
+// redactJSON returns data with secret values replaced, or a placeholder if
+// data is not JSON and so cannot be redacted safely
+func redactJSON(data []byte) string {
+    if len(data) == 0 {
+        return ""
+    }
+
+    var value interface{}
+    if err := json.Unmarshal(data, &value); err != nil {
+        return fmt.Sprintf("<%d bytes>", len(data))
+    }
+
+    redacted, err := json.Marshal(redactValue(value))
+    if err != nil {
+        return fmt.Sprintf("<%d bytes>", len(data))
+    }
+    return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+    switch v := value.(type) {
+    case map[string]interface{}:
+        for key, inner := range v {
+            if secretKeys[strings.ToLower(key)] {
+                v[key] = "[REDACTED]"
+            } else {
+                v[key] = redactValue(inner)
+            }
+        }
+    case []interface{}:
+        for i, inner := range v {
+            v[i] = redactValue(inner)
+        }
+    }
+    return value
+}
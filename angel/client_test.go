@@ -0,0 +1,105 @@
+package angel
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestClientReturnsTypedErrors(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case profilePath:
+            w.Write([]byte(`{"status":false,"message":"Invalid Token","errorcode":"AG8001","data":null}`))
+        default:
+            w.WriteHeader(http.StatusServiceUnavailable)
+            w.Write([]byte(`upstream unavailable`))
+        }
+    }))
+    defer server.Close()
+
+    client := NewClient(server.URL, time.Second)
+
+    _, err := client.Profile(context.Background(), "jwt")
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) {
+        t.Fatalf("Profile: got %v, want *APIError", err)
+    }
+    if apiErr.ErrorCode != ErrCodeInvalidToken || apiErr.HTTPStatus != http.StatusOK {
+        t.Errorf("got %+v, want code %s with HTTP 200", apiErr, ErrCodeInvalidToken)
+    }
+    if !IsAuthError(err) {
+        t.Error("AG8001 not reported as an auth error")
+    }
+
+    err = client.Do(context.Background(), http.MethodGet, "/unknown", "", nil, nil)
+    if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusServiceUnavailable {
+        t.Fatalf("Do: got %v, want *APIError with HTTP 503", err)
+    }
+    if IsAuthError(err) {
+        t.Error("HTTP 503 reported as an auth error")
+    }
+}
+
+func TestClientDecodesData(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if got := r.Header.Get("Authorization"); got != "Bearer jwt" {
+            t.Errorf("Authorization = %q, want Bearer jwt", got)
+        }
+        w.Write([]byte(`{"status":true,"message":"SUCCESS","errorcode":"","data":{"clientcode":"A123","name":"TEST","exchanges":["nse_cm"]}}`))
+    }))
+    defer server.Close()
+
+    profile, err := NewClient(server.URL, time.Second).Profile(context.Background(), "Bearer jwt")
+    if err != nil {
+        t.Fatalf("Profile: %v", err)
+    }
+    if profile.ClientCode != "A123" || len(profile.Exchanges) != 1 {
+        t.Errorf("got %+v", profile)
+    }
+}
+
+func TestRedactJSON(t *testing.T) {
+    body := []byte(`{"clientcode":"A123","password":"1234","totp":"654321","data":{"jwtToken":"secret","refreshToken":"secret","name":"TEST"}}`)
+    redacted := redactJSON(body)
+    for _, secret := range []string{"A123", "1234", "654321", "secret"} {
+        if strings.Contains(redacted, secret) {
+            t.Errorf("redacted body %s still contains %q", redacted, secret)
+        }
+    }
+    if !strings.Contains(redacted, "TEST") {
+        t.Errorf("redacted body %s lost non-secret fields", redacted)
+    }
+
+    if got := redactJSON([]byte("jwt=secret")); strings.Contains(got, "secret") {
+        t.Errorf("non-JSON body logged as %s", got)
+    }
+}
+
+func TestRateLimiterSpacesRequests(t *testing.T) {
+    limiter := newRateLimiter(20)
+    start := time.Now()
+    for i := 0; i < 3; i++ {
+        if err := limiter.Wait(context.Background()); err != nil {
+            t.Fatalf("Wait: %v", err)
+        }
+    }
+    // The first request is immediate, the next two wait 50ms each
+    if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+        t.Errorf("three requests at 20/s took %v, want at least 100ms", elapsed)
+    }
+
+    slow := newRateLimiter(0.1)
+    if err := slow.Wait(context.Background()); err != nil {
+        t.Fatalf("first Wait: %v", err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    if err := slow.Wait(ctx); !errors.Is(err, context.Canceled) {
+        t.Errorf("Wait with a cancelled context: got %v, want %v", err, context.Canceled)
+    }
+}
@@ -0,0 +1,74 @@
+package angel
+
+import (
+    "errors"
+    "fmt"
+)
+
+// Error codes returned by SmartAPI in the errorcode field
+const (
+    ErrCodeInvalidToken        = "AG8001"
+    ErrCodeTokenExpired        = "AG8002"
+    ErrCodeTokenMissing        = "AG8003"
+    ErrCodeInvalidRefreshToken = "AB8050"
+    ErrCodeRefreshTokenExpired = "AB8051"
+    ErrCodeSessionExpired      = "AB1010"
+    ErrCodeInvalidCredentials  = "AB1000"
+    ErrCodeInvalidUserType     = "AB1005"
+    ErrCodeClientBlocked       = "AB1006"
+    ErrCodeSymbolNotFound      = "AB1009"
+    ErrCodeNotConnected        = "AB1011"
+    ErrCodeInternalError       = "AB2001"
+    ErrCodeTryLater            = "AB1004"
+)
+
+// errorDescriptions documents the codes above for log messages
+var errorDescriptions = map[string]string{
+    ErrCodeInvalidToken:        "invalid token",
+    ErrCodeTokenExpired:        "token expired",
+    ErrCodeTokenMissing:        "token missing",
+    ErrCodeInvalidRefreshToken: "invalid refresh token",
+    ErrCodeRefreshTokenExpired: "refresh token expired",
+    ErrCodeSessionExpired:      "session expired",
+    ErrCodeInvalidCredentials:  "invalid client code or PIN",
+    ErrCodeInvalidUserType:     "user type must be USER",
+    ErrCodeClientBlocked:       "client is blocked for trading",
+    ErrCodeSymbolNotFound:      "symbol not found",
+    ErrCodeNotConnected:        "not connected",
+    ErrCodeInternalError:       "internal error",
+    ErrCodeTryLater:            "something went wrong, try again later",
+}
+
+// APIError is a failed SmartAPI REST call, either a non-2xx HTTP status or a
+// response with status false
+type APIError struct {
+    Endpoint   string
+    HTTPStatus int
+    ErrorCode  string
+    Message    string
+}
+
+func (e *APIError) Error() string {
+    if e.ErrorCode == "" {
+        return fmt.Sprintf("%s failed with HTTP %d: %s", e.Endpoint, e.HTTPStatus, e.Message)
+    }
+    if description, ok := errorDescriptions[e.ErrorCode]; ok && description != e.Message {
+        return fmt.Sprintf("%s failed with %s (%s): %s", e.Endpoint, e.ErrorCode, description, e.Message)
+    }
+    return fmt.Sprintf("%s failed with %s: %s", e.Endpoint, e.ErrorCode, e.Message)
+}
+
+// IsAuthError reports whether err means the JWT or refresh token is no longer
+// usable and a new login is required
+func IsAuthError(err error) bool {
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) {
+        return false
+    }
+    switch apiErr.ErrorCode {
+    case ErrCodeInvalidToken, ErrCodeTokenExpired, ErrCodeTokenMissing,
+        ErrCodeInvalidRefreshToken, ErrCodeRefreshTokenExpired, ErrCodeSessionExpired:
+        return true
+    }
+    return apiErr.HTTPStatus == 401 || apiErr.HTTPStatus == 403
+}
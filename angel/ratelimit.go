@@ -0,0 +1,56 @@
+package angel
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// Request limits published by SmartAPI, in requests per second
+var endpointRateLimits = map[string]float64{
+    loginPath:          1,
+    generateTokensPath: 1,
+    profilePath:        3,
+    candleDataPath:     3,
+}
+
+// defaultRateLimit applies to endpoints without a published limit
+const defaultRateLimit = 1
+
+// rateLimiter spaces requests at least interval apart. Waiters reserve slots
+// in arrival order, so bursts are smoothed rather than rejected.
+type rateLimiter struct {
+    mu       sync.Mutex
+    interval time.Duration
+    next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+    return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the caller may send a request or ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+    l.mu.Lock()
+    now := time.Now()
+    slot := l.next
+    if slot.Before(now) {
+        slot = now
+    }
+    l.next = slot.Add(l.interval)
+    l.mu.Unlock()
+
+    delay := time.Until(slot)
+    if delay <= 0 {
+        return nil
+    }
+
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
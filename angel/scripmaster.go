@@ -0,0 +1,371 @@
+package angel
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    DefaultScripMasterURL = "https://margincalculator.angelbroking.com/OpenAPI_File/files/OpenAPIScripMaster.json"
+
+    // expiryLayout is the format of the expiry field, e.g. 30JAN2025
+    expiryLayout = "02Jan2006"
+)
+
+var (
+    ErrInstrumentNotFound  = errors.New("instrument not found")
+    ErrAmbiguousInstrument = errors.New("instrument query matches more than one instrument")
+)
+
+// ExchangeSegments maps scrip-master exchange segments to SmartStream exchange names
+var ExchangeSegments = map[string]string{
+    "NSE":   "NSE_CM",
+    "NFO":   "NSE_FO",
+    "BSE":   "BSE_CM",
+    "BFO":   "BSE_FO",
+    "MCX":   "MCX_FO",
+    "NCDEX": "NCX_FO",
+    "CDS":   "CDE_FO",
+}
+
+// SegmentForExchange returns the scrip-master segment of a SmartStream exchange name
+func SegmentForExchange(exchange string) (string, bool) {
+    for segment, name := range ExchangeSegments {
+        if name == exchange {
+            return segment, true
+        }
+    }
+    return "", false
+}
+
+// Instrument is one entry of the OpenAPIScripMaster file. Numeric fields are
+// strings in the file; strike is quoted in paise.
+type Instrument struct {
+    Token          string `json:"token"`
+    Symbol         string `json:"symbol"`
+    Name           string `json:"name"`
+    Expiry         string `json:"expiry"`
+    Strike         string `json:"strike"`
+    LotSize        string `json:"lotsize"`
+    InstrumentType string `json:"instrumenttype"`
+    ExchSeg        string `json:"exch_seg"`
+    TickSize       string `json:"tick_size"`
+}
+
+// Exchange returns the SmartStream exchange name of the instrument's segment
+func (i *Instrument) Exchange() string {
+    return ExchangeSegments[i.ExchSeg]
+}
+
+// TickSizePrice returns the tick size in rupees
+func (i *Instrument) TickSizePrice() float64 {
+    tickSize, err := strconv.ParseFloat(i.TickSize, 64)
+    if err != nil || tickSize <= 0 {
+        return 0
+    }
+    return tickSize / 100
+}
+
+// StrikePrice returns the strike in rupees, or 0 for instruments without one
+func (i *Instrument) StrikePrice() float64 {
+    strike, err := strconv.ParseFloat(i.Strike, 64)
+    if err != nil || strike <= 0 {
+        return 0
+    }
+    return strike / 100
+}
+
+// ExpiryDate returns the expiry date, or the zero time for instruments without one
+func (i *Instrument) ExpiryDate() time.Time {
+    expiry, err := time.Parse(expiryLayout, i.Expiry)
+    if err != nil {
+        return time.Time{}
+    }
+    return expiry
+}
+
+// OptionType returns CE or PE for options and an empty string otherwise
+func (i *Instrument) OptionType() string {
+    if !strings.HasPrefix(i.InstrumentType, "OPT") {
+        return ""
+    }
+    switch {
+    case strings.HasSuffix(i.Symbol, "CE"):
+        return "CE"
+    case strings.HasSuffix(i.Symbol, "PE"):
+        return "PE"
+    }
+    return ""
+}
+
+// InstrumentQuery selects an instrument either by its exact trading symbol or
+// by underlying name plus expiry, strike and option type. Empty fields match
+// anything. Exchange accepts a SmartStream name (NSE_FO) or a segment (NFO).
+type InstrumentQuery struct {
+    Exchange   string
+    Symbol     string
+    Name       string
+    Expiry     string
+    Strike     float64
+    OptionType string
+}
+
+func (q InstrumentQuery) String() string {
+    var parts []string
+    for _, field := range [][2]string{
+        {"exchange", q.Exchange}, {"symbol", q.Symbol}, {"name", q.Name},
+        {"expiry", q.Expiry}, {"option type", q.OptionType},
+    } {
+        if field[1] != "" {
+            parts = append(parts, field[0]+" "+field[1])
+        }
+    }
+    if q.Strike > 0 {
+        parts = append(parts, "strike "+strconv.FormatFloat(q.Strike, 'f', -1, 64))
+    }
+    return strings.Join(parts, ", ")
+}
+
+// ScripMaster indexes the instrument master for lookups
+type ScripMaster struct {
+    instruments []Instrument
+    bySymbol    map[string][]int
+    byName      map[string][]int
+}
+
+// NewScripMaster indexes the given instruments
+func NewScripMaster(instruments []Instrument) *ScripMaster {
+    m := &ScripMaster{
+        instruments: instruments,
+        bySymbol:    make(map[string][]int),
+        byName:      make(map[string][]int),
+    }
+    for i := range instruments {
+        symbol := strings.ToUpper(instruments[i].Symbol)
+        name := strings.ToUpper(instruments[i].Name)
+        m.bySymbol[symbol] = append(m.bySymbol[symbol], i)
+        m.byName[name] = append(m.byName[name], i)
+    }
+    return m
+}
+
+// Instruments returns every instrument in file order
+func (m *ScripMaster) Instruments() []Instrument {
+    return m.instruments
+}
+
+// Len returns the number of instruments
+func (m *ScripMaster) Len() int {
+    return len(m.instruments)
+}
+
+// Resolve returns the single instrument matching q
+func (m *ScripMaster) Resolve(q InstrumentQuery) (*Instrument, error) {
+    var candidates []int
+    switch {
+    case q.Symbol != "":
+        candidates = m.bySymbol[strings.ToUpper(q.Symbol)]
+    case q.Name != "":
+        candidates = m.byName[strings.ToUpper(q.Name)]
+    default:
+        return nil, fmt.Errorf("instrument query needs a symbol or a name")
+    }
+
+    var expiry time.Time
+    if q.Expiry != "" {
+        parsed, err := parseExpiry(q.Expiry)
+        if err != nil {
+            return nil, err
+        }
+        expiry = parsed
+    }
+
+    var match *Instrument
+    for _, index := range candidates {
+        instrument := &m.instruments[index]
+        if !q.matches(instrument, expiry) {
+            continue
+        }
+        if match != nil {
+            return nil, fmt.Errorf("%w: %s (%s and %s)", ErrAmbiguousInstrument, q, match.Symbol, instrument.Symbol)
+        }
+        match = instrument
+    }
+    if match == nil {
+        return nil, fmt.Errorf("%w: %s", ErrInstrumentNotFound, q)
+    }
+    return match, nil
+}
+
+func (q InstrumentQuery) matches(instrument *Instrument, expiry time.Time) bool {
+    if q.Exchange != "" {
+        exchange := strings.ToUpper(q.Exchange)
+        if exchange != instrument.ExchSeg && exchange != instrument.Exchange() {
+            return false
+        }
+    }
+    if !expiry.IsZero() && !expiry.Equal(instrument.ExpiryDate()) {
+        return false
+    }
+    if q.Strike > 0 && math.Abs(q.Strike-instrument.StrikePrice()) > 1e-6 {
+        return false
+    }
+    if q.OptionType != "" && strings.ToUpper(q.OptionType) != instrument.OptionType() {
+        return false
+    }
+    return true
+}
+
+// parseExpiry accepts the scrip-master format (30JAN2025) and ISO dates (2025-01-30)
+func parseExpiry(value string) (time.Time, error) {
+    for _, layout := range []string{expiryLayout, "2006-01-02"} {
+        if expiry, err := time.Parse(layout, value); err == nil {
+            return expiry, nil
+        }
+    }
+    return time.Time{}, fmt.Errorf("invalid expiry %q: use 30JAN2025 or 2025-01-30", value)
+}
+
+// ScripMasterLoader fetches the instrument master and caches it on disk. The
+// file is published once a day, so a cache written since the latest
+// publication is used without downloading.
+type ScripMasterLoader struct {
+    // URL to download from; when empty only CacheFile is read
+    URL string
+    // CacheFile holds the last download and may also be provided by hand
+    CacheFile  string
+    HTTPClient *http.Client
+    // PublishedAt is the time of day in IST a new master is published; a
+    // cache written before the latest publication is stale
+    PublishedAt time.Duration
+}
+
+// Load returns the instrument master from a fresh cache, a download, or a
+// stale cache when the download fails
+func (l *ScripMasterLoader) Load(ctx context.Context) (*ScripMaster, error) {
+    if l.CacheFile != "" && (l.URL == "" || l.cacheIsFresh()) {
+        instruments, err := readInstruments(l.CacheFile)
+        if err == nil {
+            return NewScripMaster(instruments), nil
+        }
+        if l.URL == "" {
+            return nil, err
+        }
+        log.Printf("Ignoring scrip master cache: %v", err)
+    }
+
+    instruments, err := l.download(ctx)
+    if err != nil {
+        if l.CacheFile != "" {
+            if cached, cacheErr := readInstruments(l.CacheFile); cacheErr == nil {
+                log.Printf("Failed to download scrip master, using cached copy: %v", err)
+                return NewScripMaster(cached), nil
+            }
+        }
+        return nil, err
+    }
+    return NewScripMaster(instruments), nil
+}
+
+func (l *ScripMasterLoader) cacheIsFresh() bool {
+    info, err := os.Stat(l.CacheFile)
+    if err != nil {
+        return false
+    }
+    return !info.ModTime().Before(lastScripMasterPublish(time.Now(), l.PublishedAt))
+}
+
+// NextScripMasterPublish returns the first publication after now of a master
+// published daily at the time of day at, in IST
+func NextScripMasterPublish(now time.Time, at time.Duration) time.Time {
+    return lastScripMasterPublish(now, at).AddDate(0, 0, 1)
+}
+
+// lastScripMasterPublish returns the latest publication at or before now
+func lastScripMasterPublish(now time.Time, at time.Duration) time.Time {
+    y, m, d := now.In(IST).Date()
+    published := time.Date(y, m, d, 0, 0, 0, 0, IST).Add(at)
+    if published.After(now) {
+        published = published.AddDate(0, 0, -1)
+    }
+    return published
+}
+
+func (l *ScripMasterLoader) download(ctx context.Context) ([]Instrument, error) {
+    client := l.HTTPClient
+    if client == nil {
+        client = &http.Client{Timeout: time.Minute}
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.URL, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create scrip master request: %v", err)
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to download scrip master: %v", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("failed to download scrip master: HTTP %d", resp.StatusCode)
+    }
+
+    data, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read scrip master: %v", err)
+    }
+
+    var instruments []Instrument
+    if err := json.Unmarshal(data, &instruments); err != nil {
+        return nil, fmt.Errorf("failed to decode scrip master: %v", err)
+    }
+
+    if l.CacheFile != "" {
+        if err := writeFileAtomic(l.CacheFile, data); err != nil {
+            log.Printf("Failed to cache scrip master: %v", err)
+        }
+    }
+    return instruments, nil
+}
+
+func readInstruments(path string) ([]Instrument, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read scrip master: %v", err)
+    }
+    var instruments []Instrument
+    if err := json.Unmarshal(data, &instruments); err != nil {
+        return nil, fmt.Errorf("failed to decode scrip master %s: %v", path, err)
+    }
+    return instruments, nil
+}
+
+// writeFileAtomic replaces path with data via a temporary file in the same directory
+func writeFileAtomic(path string, data []byte) error {
+    tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+    if err != nil {
+        return err
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    return os.Rename(tmp.Name(), path)
+}
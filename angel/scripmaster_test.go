@@ -0,0 +1,89 @@
+package angel
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+const testScripMaster = `[
+    {"token":"2885","symbol":"RELIANCE-EQ","name":"RELIANCE","expiry":"","strike":"-1.000000","lotsize":"1","instrumenttype":"","exch_seg":"NSE","tick_size":"5.000000"},
+    {"token":"43607","symbol":"NIFTY30JAN2523200PE","name":"NIFTY","expiry":"30JAN2025","strike":"2320000.000000","lotsize":"75","instrumenttype":"OPTIDX","exch_seg":"NFO","tick_size":"5.000000"},
+    {"token":"43606","symbol":"NIFTY30JAN2523200CE","name":"NIFTY","expiry":"30JAN2025","strike":"2320000.000000","lotsize":"75","instrumenttype":"OPTIDX","exch_seg":"NFO","tick_size":"5.000000"},
+    {"token":"43700","symbol":"NIFTY27FEB2523200PE","name":"NIFTY","expiry":"27FEB2025","strike":"2320000.000000","lotsize":"75","instrumenttype":"OPTIDX","exch_seg":"NFO","tick_size":"5.000000"}
+]`
+
+func TestScripMasterResolve(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(testScripMaster))
+    }))
+    defer server.Close()
+
+    cache := filepath.Join(t.TempDir(), "scripmaster.json")
+    master, err := (&ScripMasterLoader{URL: server.URL, CacheFile: cache}).Load(context.Background())
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+
+    tests := []struct {
+        query    InstrumentQuery
+        token    string
+        exchange string
+    }{
+        {InstrumentQuery{Symbol: "reliance-eq"}, "2885", "NSE_CM"},
+        {InstrumentQuery{Exchange: "NSE_FO", Name: "NIFTY", Expiry: "30JAN2025", Strike: 23200, OptionType: "pe"}, "43607", "NSE_FO"},
+        {InstrumentQuery{Exchange: "NFO", Name: "NIFTY", Expiry: "2025-02-27", Strike: 23200, OptionType: "PE"}, "43700", "NSE_FO"},
+    }
+    for _, tt := range tests {
+        instrument, err := master.Resolve(tt.query)
+        if err != nil {
+            t.Errorf("Resolve(%s): %v", tt.query, err)
+            continue
+        }
+        if instrument.Token != tt.token || instrument.Exchange() != tt.exchange {
+            t.Errorf("Resolve(%s) = %s on %s, want %s on %s", tt.query, instrument.Token, instrument.Exchange(), tt.token, tt.exchange)
+        }
+    }
+
+    if _, err := master.Resolve(InstrumentQuery{Name: "NIFTY", Expiry: "30JAN2025"}); !errors.Is(err, ErrAmbiguousInstrument) {
+        t.Errorf("ambiguous query: got %v, want %v", err, ErrAmbiguousInstrument)
+    }
+    if _, err := master.Resolve(InstrumentQuery{Exchange: "BSE_CM", Symbol: "RELIANCE-EQ"}); !errors.Is(err, ErrInstrumentNotFound) {
+        t.Errorf("wrong exchange: got %v, want %v", err, ErrInstrumentNotFound)
+    }
+
+    // The download was cached and is readable without the URL
+    if _, err := os.Stat(cache); err != nil {
+        t.Fatalf("scrip master not cached: %v", err)
+    }
+    cached, err := (&ScripMasterLoader{CacheFile: cache}).Load(context.Background())
+    if err != nil {
+        t.Fatalf("Load from cache: %v", err)
+    }
+    if cached.Len() != master.Len() {
+        t.Errorf("cached master has %d instruments, want %d", cached.Len(), master.Len())
+    }
+}
+
+func TestNextScripMasterPublish(t *testing.T) {
+    at := 8*time.Hour + 30*time.Minute
+    tests := []struct {
+        now, want time.Time
+    }{
+        {time.Date(2025, 1, 10, 7, 0, 0, 0, IST), time.Date(2025, 1, 10, 8, 30, 0, 0, IST)},
+        {time.Date(2025, 1, 10, 8, 30, 0, 0, IST), time.Date(2025, 1, 11, 8, 30, 0, 0, IST)},
+        {time.Date(2025, 1, 10, 23, 0, 0, 0, IST), time.Date(2025, 1, 11, 8, 30, 0, 0, IST)},
+        // 01:00 UTC on the 10th is 06:30 IST on the 10th
+        {time.Date(2025, 1, 10, 1, 0, 0, 0, time.UTC), time.Date(2025, 1, 10, 8, 30, 0, 0, IST)},
+    }
+    for _, tt := range tests {
+        if got := NextScripMasterPublish(tt.now, at); !got.Equal(tt.want) {
+            t.Errorf("NextScripMasterPublish(%v) = %v, want %v", tt.now, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,337 @@
+package angel
+
+import (
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    // DefaultRefreshMargin is how long before expiry the JWT is refreshed
+    DefaultRefreshMargin = 10 * time.Minute
+    // DefaultSessionLifetime is assumed when the JWT carries no exp claim
+    DefaultSessionLifetime = 12 * time.Hour
+
+    // retryDelay is how long Run waits after a failed refresh
+    retryDelay = time.Minute
+    // minRefreshDelay is the least Run waits after a refresh, so a JWT that
+    // expires within RefreshMargin is not refreshed in a tight loop
+    minRefreshDelay = time.Minute
+)
+
+// Session caches the tokens of one SmartAPI login and keeps them fresh. It is
+// safe for concurrent use, so the WebSocket connections and REST calls can
+// share a single session instead of logging in separately.
+type Session struct {
+    client *Client
+
+    // CacheFile, when set, persists the tokens encrypted with CacheKey so a
+    // restart reuses the session instead of logging in again
+    CacheFile string
+    CacheKey  string
+
+    // RefreshMargin is how long before expiry Ensure and Run refresh the JWT
+    RefreshMargin time.Duration
+
+    // mu guards tokens and is only held to read or swap them, never across a
+    // request, so readers are not blocked while a login is in flight
+    mu     sync.RWMutex
+    tokens sessionTokens
+
+    // renewMu serializes logins and refreshes, so concurrent callers of
+    // Ensure wait for one renewal instead of each starting their own
+    renewMu sync.Mutex
+}
+
+// sessionTokens is the session state, also the plaintext of the cache file
+type sessionTokens struct {
+    JwtToken     string    `json:"jwt_token"`
+    FeedToken    string    `json:"feed_token"`
+    RefreshToken string    `json:"refresh_token"`
+    ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func NewSession(client *Client) *Session {
+    return &Session{
+        client:        client,
+        RefreshMargin: DefaultRefreshMargin,
+    }
+}
+
+// JwtToken returns the current JWT
+func (s *Session) JwtToken() string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.tokens.JwtToken
+}
+
+// FeedToken returns the current feed token used by SmartStream
+func (s *Session) FeedToken() string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.tokens.FeedToken
+}
+
+// ExpiresAt returns when the current JWT expires
+func (s *Session) ExpiresAt() time.Time {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.tokens.ExpiresAt
+}
+
+// Valid reports whether the session has a JWT that is not due for refresh
+func (s *Session) Valid() bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.valid()
+}
+
+func (s *Session) valid() bool {
+    return s.tokens.JwtToken != "" && time.Now().Add(s.RefreshMargin).Before(s.tokens.ExpiresAt)
+}
+
+// Ensure makes the session usable: it loads the cache file on first use,
+// refreshes a JWT that is close to expiry and falls back to a full login
+// when there is no session or the refresh fails
+func (s *Session) Ensure() error {
+    s.renewMu.Lock()
+    defer s.renewMu.Unlock()
+
+    s.mu.Lock()
+    if s.tokens.JwtToken == "" && s.CacheFile != "" {
+        if err := s.load(); err != nil {
+            log.Printf("Ignoring session cache: %v", err)
+        }
+    }
+    valid, current := s.valid(), s.tokens
+    s.mu.Unlock()
+
+    if valid {
+        return nil
+    }
+
+    if current.RefreshToken != "" {
+        err := s.refresh(current)
+        if err == nil {
+            return nil
+        }
+        if !IsAuthError(err) {
+            return err
+        }
+        log.Printf("Session refresh rejected, logging in again: %v", err)
+    }
+
+    return s.login()
+}
+
+// Refresh exchanges the refresh token for new tokens, logging in again if
+// there is no refresh token
+func (s *Session) Refresh() error {
+    s.renewMu.Lock()
+    defer s.renewMu.Unlock()
+
+    s.mu.RLock()
+    current := s.tokens
+    s.mu.RUnlock()
+
+    if current.RefreshToken == "" {
+        return s.login()
+    }
+    return s.refresh(current)
+}
+
+// Run refreshes the session shortly before each expiry until ctx is cancelled.
+// After the first attempt it waits at least minRefreshDelay between refreshes,
+// or retryDelay after a failure.
+func (s *Session) Run(ctx context.Context) {
+    var delay time.Duration
+    for {
+        wait := time.Until(s.ExpiresAt()) - s.RefreshMargin
+        if wait < delay {
+            wait = delay
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-time.After(wait):
+        }
+
+        if err := s.Ensure(); err != nil {
+            log.Printf("Failed to refresh session: %v, retrying in %v", err, retryDelay)
+            delay = retryDelay
+            continue
+        }
+
+        delay = minRefreshDelay
+        if !s.Valid() {
+            log.Printf("Session expires at %v, within the %v refresh margin; refreshing again in %v",
+                s.ExpiresAt(), s.RefreshMargin, delay)
+        }
+    }
+}
+
+// login performs a full login. Must be called with renewMu held.
+func (s *Session) login() error {
+    tokens, err := s.client.Login(context.Background())
+    if err != nil {
+        return err
+    }
+    return s.update(tokens)
+}
+
+// refresh exchanges the tokens of current at the generate-tokens endpoint.
+// Must be called with renewMu held.
+func (s *Session) refresh(current sessionTokens) error {
+    tokens, err := s.client.GenerateTokens(context.Background(), current.JwtToken, current.RefreshToken)
+    if err != nil {
+        return err
+    }
+    return s.update(tokens)
+}
+
+// update swaps in new tokens and persists them
+func (s *Session) update(resp *Tokens) error {
+    if resp.JwtToken == "" {
+        return errors.New("token response has no jwtToken")
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    tokens := sessionTokens{
+        JwtToken:     strings.TrimPrefix(resp.JwtToken, "Bearer "),
+        FeedToken:    resp.FeedToken,
+        RefreshToken: resp.RefreshToken,
+        ExpiresAt:    jwtExpiry(resp.JwtToken),
+    }
+    // generateTokens may omit tokens that did not change
+    if tokens.FeedToken == "" {
+        tokens.FeedToken = s.tokens.FeedToken
+    }
+    if tokens.RefreshToken == "" {
+        tokens.RefreshToken = s.tokens.RefreshToken
+    }
+    s.tokens = tokens
+
+    if s.CacheFile != "" {
+        if err := s.save(); err != nil {
+            log.Printf("Failed to write session cache: %v", err)
+        }
+    }
+    return nil
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it
+func jwtExpiry(token string) time.Time {
+    fallback := time.Now().Add(DefaultSessionLifetime)
+
+    parts := strings.Split(strings.TrimPrefix(token, "Bearer "), ".")
+    if len(parts) != 3 {
+        return fallback
+    }
+    payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+    if err != nil {
+        return fallback
+    }
+
+    var claims struct {
+        Exp int64 `json:"exp"`
+    }
+    if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+        return fallback
+    }
+    return time.Unix(claims.Exp, 0)
+}
+
+// load reads the cache file. Must be called with mu held.
+func (s *Session) load() error {
+    data, err := os.ReadFile(s.CacheFile)
+    if err != nil {
+        if errors.Is(err, os.ErrNotExist) {
+            return nil
+        }
+        return err
+    }
+
+    plaintext, err := s.decrypt(data)
+    if err != nil {
+        return err
+    }
+
+    var tokens sessionTokens
+    if err := json.Unmarshal(plaintext, &tokens); err != nil {
+        return fmt.Errorf("failed to decode session cache: %v", err)
+    }
+    s.tokens = tokens
+    return nil
+}
+
+// save writes the cache file atomically with owner-only permissions. Must be
+// called with mu held.
+func (s *Session) save() error {
+    plaintext, err := json.Marshal(s.tokens)
+    if err != nil {
+        return err
+    }
+    data, err := s.encrypt(plaintext)
+    if err != nil {
+        return err
+    }
+
+    return writeFileAtomic(s.CacheFile, data)
+}
+
+// aead derives an AES-256-GCM cipher from CacheKey
+func (s *Session) aead() (cipher.AEAD, error) {
+    if s.CacheKey == "" {
+        return nil, errors.New("session cache key is not set")
+    }
+    key := sha256.Sum256([]byte(s.CacheKey))
+    block, err := aes.NewCipher(key[:])
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
+
+// encrypt returns nonce || ciphertext
+func (s *Session) encrypt(plaintext []byte) ([]byte, error) {
+    gcm, err := s.aead()
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, err
+    }
+    return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (s *Session) decrypt(data []byte) ([]byte, error) {
+    gcm, err := s.aead()
+    if err != nil {
+        return nil, err
+    }
+    if len(data) < gcm.NonceSize() {
+        return nil, errors.New("session cache is truncated")
+    }
+    nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+    plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt session cache: %v", err)
+    }
+    return plaintext, nil
+}
@@ -0,0 +1,195 @@
+package angel
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func testJWT(exp time.Time) string {
+    claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+    return "eyJhbGciOiJIUzUxMiJ9." + claims + ".signature"
+}
+
+func TestSessionRefreshesWithRefreshToken(t *testing.T) {
+    fresh := testJWT(time.Now().Add(time.Hour))
+    var refreshes int
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != generateTokensPath {
+            t.Errorf("unexpected request to %s", r.URL.Path)
+            http.NotFound(w, r)
+            return
+        }
+        refreshes++
+        if got := r.Header.Get("Authorization"); got != "Bearer old-jwt" {
+            t.Errorf("Authorization = %q, want Bearer old-jwt", got)
+        }
+        var body map[string]string
+        json.NewDecoder(r.Body).Decode(&body)
+        if body["refreshToken"] != "refresh-1" {
+            t.Errorf("refreshToken = %q, want refresh-1", body["refreshToken"])
+        }
+        fmt.Fprintf(w, `{"status":true,"data":{"jwtToken":"Bearer %s","refreshToken":"refresh-2"}}`, fresh)
+    }))
+    defer server.Close()
+
+    session := NewSession(NewClient(server.URL+"/", time.Second))
+    session.tokens = sessionTokens{
+        JwtToken:     "old-jwt",
+        FeedToken:    "feed-1",
+        RefreshToken: "refresh-1",
+        ExpiresAt:    time.Now().Add(time.Minute),
+    }
+
+    if err := session.Ensure(); err != nil {
+        t.Fatalf("Ensure: %v", err)
+    }
+    if refreshes != 1 {
+        t.Fatalf("got %d refreshes, want 1", refreshes)
+    }
+    if session.JwtToken() != fresh {
+        t.Errorf("JwtToken = %q, want the refreshed token", session.JwtToken())
+    }
+    if session.FeedToken() != "feed-1" {
+        t.Errorf("FeedToken = %q, want the previous feed token kept", session.FeedToken())
+    }
+    if !session.Valid() {
+        t.Error("session not valid after refresh")
+    }
+
+    // A valid session is reused without another request
+    if err := session.Ensure(); err != nil {
+        t.Fatalf("second Ensure: %v", err)
+    }
+    if refreshes != 1 {
+        t.Errorf("got %d refreshes after reuse, want 1", refreshes)
+    }
+}
+
+func TestSessionCacheRoundTrip(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "session")
+    want := sessionTokens{
+        JwtToken:     testJWT(time.Now().Add(time.Hour)),
+        FeedToken:    "feed",
+        RefreshToken: "refresh",
+        ExpiresAt:    time.Now().Add(time.Hour).Truncate(time.Second),
+    }
+
+    writer := NewSession(NewClient("http://127.0.0.1:1", time.Second))
+    writer.CacheFile = path
+    writer.CacheKey = "passphrase"
+    writer.tokens = want
+    if err := writer.save(); err != nil {
+        t.Fatalf("save: %v", err)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatalf("ReadFile: %v", err)
+    }
+    if json.Valid(data) {
+        t.Error("cache file is stored in plaintext")
+    }
+
+    // Ensure must not contact the unreachable base URL when the cache is valid
+    reader := NewSession(NewClient("http://127.0.0.1:1", time.Second))
+    reader.CacheFile = path
+    reader.CacheKey = "passphrase"
+    if err := reader.Ensure(); err != nil {
+        t.Fatalf("Ensure: %v", err)
+    }
+    if !reader.tokens.ExpiresAt.Equal(want.ExpiresAt) || reader.JwtToken() != want.JwtToken ||
+        reader.FeedToken() != want.FeedToken || reader.tokens.RefreshToken != want.RefreshToken {
+        t.Errorf("loaded %+v, want %+v", reader.tokens, want)
+    }
+
+    wrongKey := NewSession(NewClient("http://127.0.0.1:1", time.Second))
+    wrongKey.CacheFile = path
+    wrongKey.CacheKey = "other"
+    if err := wrongKey.load(); err == nil {
+        t.Error("cache decrypted with the wrong key")
+    }
+}
+
+// refreshServer answers generate-tokens requests with jwt, calling wait
+// first if it is set, and counts the requests it served
+func refreshServer(t *testing.T, jwt string, wait func()) (*httptest.Server, *atomic.Int32) {
+    var refreshes atomic.Int32
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        refreshes.Add(1)
+        if wait != nil {
+            wait()
+        }
+        fmt.Fprintf(w, `{"status":true,"data":{"jwtToken":"Bearer %s","refreshToken":"refresh-2"}}`, jwt)
+    }))
+    t.Cleanup(server.Close)
+    return server, &refreshes
+}
+
+func TestSessionRunBacksOffWhenRefreshedJWTExpiresSoon(t *testing.T) {
+    // The new JWT is already inside the ten minute refresh margin
+    server, refreshes := refreshServer(t, testJWT(time.Now().Add(time.Minute)), nil)
+
+    session := NewSession(NewClient(server.URL+"/", time.Second))
+    session.tokens = sessionTokens{JwtToken: "old-jwt", RefreshToken: "refresh-1", ExpiresAt: time.Now()}
+
+    ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+    defer cancel()
+    session.Run(ctx)
+
+    if got := refreshes.Load(); got != 1 {
+        t.Errorf("got %d refreshes, want 1 before the minimum refresh delay", got)
+    }
+}
+
+func TestSessionEnsureDoesNotBlockReaders(t *testing.T) {
+    arrived := make(chan struct{})
+    release := make(chan struct{})
+    fresh := testJWT(time.Now().Add(time.Hour))
+    server, refreshes := refreshServer(t, fresh, func() {
+        close(arrived)
+        <-release
+    })
+
+    session := NewSession(NewClient(server.URL+"/", 5*time.Second))
+    session.tokens = sessionTokens{JwtToken: "old-jwt", RefreshToken: "refresh-1", ExpiresAt: time.Now()}
+
+    ensured := make(chan error, 2)
+    go func() { ensured <- session.Ensure() }()
+    <-arrived
+
+    // A second caller waits for the refresh in flight instead of starting one
+    go func() { ensured <- session.Ensure() }()
+
+    read := make(chan string)
+    go func() { read <- session.JwtToken() }()
+    select {
+    case got := <-read:
+        if got != "old-jwt" {
+            t.Errorf("JwtToken during refresh = %q, want old-jwt", got)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("JwtToken blocked while the refresh was in flight")
+    }
+
+    close(release)
+    for i := 0; i < 2; i++ {
+        if err := <-ensured; err != nil {
+            t.Fatalf("Ensure: %v", err)
+        }
+    }
+    if got := refreshes.Load(); got != 1 {
+        t.Errorf("got %d refreshes, want 1", got)
+    }
+    if session.JwtToken() != fresh {
+        t.Errorf("JwtToken = %q, want the refreshed token", session.JwtToken())
+    }
+}
@@ -0,0 +1,57 @@
+package angel
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "angelone_clickhouse/config"
+)
+
+// TestLoginAgainstLocalStandIn points the configured REST endpoint at a local
+// server and logs in through a Session as the collector does at startup
+func TestLoginAgainstLocalStandIn(t *testing.T) {
+    jwt := testJWT(time.Now().Add(time.Hour))
+
+    var loginBody map[string]string
+    rest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != loginPath {
+            http.NotFound(w, r)
+            return
+        }
+        json.NewDecoder(r.Body).Decode(&loginBody)
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status": true,
+            "data":   map[string]string{"jwtToken": jwt, "refreshToken": "refresh", "feedToken": "feed"},
+        })
+    }))
+    defer rest.Close()
+
+    t.Setenv("ANGEL_API_BASE_URL", rest.URL)
+    t.Setenv("ANGEL_SESSION_FILE", "")
+    t.Setenv("ANGEL_TOTP_SECRET", "")
+    t.Setenv("ANGEL_TOTP_CODE", "123456")
+    t.Setenv("ANGEL_CLIENT_ID", "A123")
+    t.Setenv("ANGEL_CLIENT_PIN", "1234")
+
+    cfg, err := config.Load()
+    if err != nil {
+        t.Fatalf("config.Load: %v", err)
+    }
+
+    session := NewSession(NewClient(cfg.AngelOne.BaseURL, cfg.AngelOne.RequestTimeout))
+    if err := session.Ensure(); err != nil {
+        t.Fatalf("login against stand-in: %v", err)
+    }
+    if loginBody["clientcode"] != "A123" || loginBody["password"] != "1234" || loginBody["totp"] != "123456" {
+        t.Errorf("login sent %v", loginBody)
+    }
+    if session.JwtToken() != jwt || session.FeedToken() != "feed" {
+        t.Errorf("session holds JWT %q and feed token %q, want the ones from login", session.JwtToken(), session.FeedToken())
+    }
+    if !session.Valid() {
+        t.Error("session not valid after login")
+    }
+}
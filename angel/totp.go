@@ -0,0 +1,133 @@
+package angel
+
+import (
+    "crypto/hmac"
+    "crypto/sha1"
+    "encoding/base32"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash"
+    "strings"
+    "time"
+)
+
+const (
+    DefaultTOTPDigits = 6
+    DefaultTOTPPeriod = 30 * time.Second
+    // DefaultTOTPMinValidity is how long a generated code must stay valid so
+    // it does not expire between generation and the login request
+    DefaultTOTPMinValidity = 3 * time.Second
+)
+
+var ErrEmptyTOTPSecret = errors.New("empty TOTP secret")
+
+// TOTP generates RFC 6238 time-based one-time passwords
+type TOTP struct {
+    Secret    []byte
+    Digits    int
+    Period    time.Duration
+    Algorithm func() hash.Hash
+
+    // Skew is added to the local clock, for hosts whose clock is known to drift
+    Skew time.Duration
+    // MinValidity makes Generate wait for the next time step instead of
+    // returning a code that expires sooner than this
+    MinValidity time.Duration
+
+    now   func() time.Time
+    sleep func(time.Duration)
+}
+
+// NewTOTP creates a six digit, 30 second, HMAC-SHA1 generator from a base32
+// secret as shown by the AngelOne TOTP setup page. Spaces, hyphens, padding
+// and lower case letters are accepted.
+func NewTOTP(secret string) (*TOTP, error) {
+    normalized := strings.ToUpper(strings.NewReplacer(" ", "", "-", "", "=", "").Replace(secret))
+    if normalized == "" {
+        return nil, ErrEmptyTOTPSecret
+    }
+
+    key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+    if err != nil {
+        return nil, fmt.Errorf("invalid TOTP secret: %v", err)
+    }
+
+    return &TOTP{
+        Secret:      key,
+        Digits:      DefaultTOTPDigits,
+        Period:      DefaultTOTPPeriod,
+        Algorithm:   sha1.New,
+        MinValidity: DefaultTOTPMinValidity,
+    }, nil
+}
+
+// At returns the code for the time step containing ts
+func (t *TOTP) At(ts time.Time) string {
+    return t.code(t.step(ts))
+}
+
+// Generate returns the code for the current time step. When the step has
+// less than MinValidity left it waits for the next step first, so a fresh
+// code is used for every login attempt.
+func (t *TOTP) Generate() string {
+    now, sleep := time.Now, time.Sleep
+    if t.now != nil {
+        now = t.now
+    }
+    if t.sleep != nil {
+        sleep = t.sleep
+    }
+
+    ts := now().Add(t.Skew)
+    if remaining := t.remaining(ts); remaining < t.MinValidity {
+        sleep(remaining)
+        ts = ts.Add(remaining)
+    }
+    return t.At(ts)
+}
+
+// Verify reports whether code matches the time step containing ts or any of
+// the window steps before and after it
+func (t *TOTP) Verify(code string, ts time.Time, window int) bool {
+    step := t.step(ts)
+    for i := -int64(window); i <= int64(window); i++ {
+        if step+i < 0 {
+            continue
+        }
+        if hmac.Equal([]byte(t.code(step+i)), []byte(code)) {
+            return true
+        }
+    }
+    return false
+}
+
+func (t *TOTP) step(ts time.Time) int64 {
+    return ts.Unix() / int64(t.Period/time.Second)
+}
+
+// remaining returns how long the code for the step containing ts stays valid
+func (t *TOTP) remaining(ts time.Time) time.Duration {
+    period := int64(t.Period / time.Second)
+    end := time.Unix((t.step(ts)+1)*period, 0)
+    return end.Sub(ts)
+}
+
+// code implements the HOTP truncation of RFC 4226 for the given counter
+func (t *TOTP) code(counter int64) string {
+    var msg [8]byte
+    binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+    mac := hmac.New(t.Algorithm, t.Secret)
+    mac.Write(msg[:])
+    sum := mac.Sum(nil)
+
+    offset := sum[len(sum)-1] & 0x0f
+    value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+    modulus := uint32(1)
+    for i := 0; i < t.Digits; i++ {
+        modulus *= 10
+    }
+    return fmt.Sprintf("%0*d", t.Digits, value%modulus)
+}
@@ -0,0 +1,112 @@
+package angel
+
+import (
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/base32"
+    "hash"
+    "testing"
+    "time"
+)
+
+// Test vectors from RFC 6238 Appendix B
+func TestTOTPRFC6238Vectors(t *testing.T) {
+    algorithms := []struct {
+        name   string
+        hash   func() hash.Hash
+        secret string
+    }{
+        {"SHA1", sha1.New, "12345678901234567890"},
+        {"SHA256", sha256.New, "12345678901234567890123456789012"},
+        {"SHA512", sha512.New, "1234567890123456789012345678901234567890123456789012345678901234"},
+    }
+
+    vectors := []struct {
+        unix  int64
+        codes [3]string
+    }{
+        {59, [3]string{"94287082", "46119246", "90693936"}},
+        {1111111109, [3]string{"07081804", "68084774", "25091201"}},
+        {1111111111, [3]string{"14050471", "67062674", "99943326"}},
+        {1234567890, [3]string{"89005924", "91819424", "93441116"}},
+        {2000000000, [3]string{"69279037", "90698825", "38618901"}},
+        {20000000000, [3]string{"65353130", "77737706", "47863826"}},
+    }
+
+    for i, alg := range algorithms {
+        totp := &TOTP{
+            Secret:    []byte(alg.secret),
+            Digits:    8,
+            Period:    30 * time.Second,
+            Algorithm: alg.hash,
+        }
+        for _, v := range vectors {
+            if got := totp.At(time.Unix(v.unix, 0)); got != v.codes[i] {
+                t.Errorf("%s at %d: got %s, want %s", alg.name, v.unix, got, v.codes[i])
+            }
+        }
+    }
+}
+
+func TestNewTOTPDecodesBase32Secret(t *testing.T) {
+    encoded := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+    totp, err := NewTOTP(" " + encoded[:8] + "-" + encoded[8:] + " ")
+    if err != nil {
+        t.Fatalf("NewTOTP: %v", err)
+    }
+    // Six digit codes are the last six digits of the RFC SHA1 vectors
+    if got := totp.At(time.Unix(1111111109, 0)); got != "081804" {
+        t.Errorf("got %s, want 081804", got)
+    }
+
+    if _, err := NewTOTP(""); err != ErrEmptyTOTPSecret {
+        t.Errorf("empty secret: got %v, want %v", err, ErrEmptyTOTPSecret)
+    }
+    if _, err := NewTOTP("not base32!"); err == nil {
+        t.Error("invalid secret: expected an error")
+    }
+}
+
+func TestTOTPGenerateWaitsNearStepEnd(t *testing.T) {
+    totp, err := NewTOTP(base32.StdEncoding.EncodeToString([]byte("12345678901234567890")))
+    if err != nil {
+        t.Fatalf("NewTOTP: %v", err)
+    }
+
+    // 1111111109 is one second before the step ends
+    var slept time.Duration
+    totp.now = func() time.Time { return time.Unix(1111111109, 0) }
+    totp.sleep = func(d time.Duration) { slept = d }
+
+    if got := totp.Generate(); got != "050471" {
+        t.Errorf("got %s, want the next step's code 050471", got)
+    }
+    if slept != time.Second {
+        t.Errorf("slept %v, want 1s", slept)
+    }
+
+    slept = 0
+    totp.now = func() time.Time { return time.Unix(1111111100, 0) }
+    if got := totp.Generate(); got != "081804" {
+        t.Errorf("got %s, want 081804", got)
+    }
+    if slept != 0 {
+        t.Errorf("slept %v with enough validity left", slept)
+    }
+}
+
+func TestTOTPVerifyToleratesSkew(t *testing.T) {
+    totp := &TOTP{Secret: []byte("12345678901234567890"), Digits: 8, Period: 30 * time.Second, Algorithm: sha1.New}
+    code := totp.At(time.Unix(1111111109, 0))
+
+    if !totp.Verify(code, time.Unix(1111111111, 0), 1) {
+        t.Error("code from the previous step rejected with window 1")
+    }
+    if totp.Verify(code, time.Unix(1111111111, 0), 0) {
+        t.Error("code from the previous step accepted with window 0")
+    }
+    if totp.Verify(code, time.Unix(1111111109+90, 0), 1) {
+        t.Error("code from three steps earlier accepted with window 1")
+    }
+}
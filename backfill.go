@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/config"
+	"angelone_clickhouse/db"
+	"angelone_clickhouse/models"
+)
+
+// backfillToken is one instrument to backfill
+type backfillToken struct {
+	exchange string
+	token    string
+}
+
+// runBackfill fetches historical candles for a token list and date range and
+// stores them in the candles table. Candles replace existing rows with the
+// same key, so overlapping or repeated runs never duplicate data.
+//
+//	go run . backfill -from 2025-01-10 -to "2025-01-10 15:30" -interval ONE_MINUTE -tokens NSE_CM:2885,NSE_FO:43607
+func runBackfill(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	from := flags.String("from", "", "start of the range in IST, YYYY-MM-DD or \"YYYY-MM-DD HH:MM\" (required)")
+	to := flags.String("to", "", "end of the range in IST, a date alone includes the whole day; defaults to now")
+	interval := flags.String("interval", angel.IntervalOneMinute, "candle interval, e.g. ONE_MINUTE or ONE_DAY")
+	tokenList := flags.String("tokens", "", "comma separated EXCHANGE:TOKEN list, defaults to config/tokens.json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if _, ok := angel.CandleIntervals[*interval]; !ok {
+		return fmt.Errorf("unknown interval %q", *interval)
+	}
+	if *from == "" {
+		return fmt.Errorf("-from is required")
+	}
+	start, err := parseBackfillTime(*from, false)
+	if err != nil {
+		return err
+	}
+	end := time.Now().In(angel.IST)
+	if *to != "" {
+		if end, err = parseBackfillTime(*to, true); err != nil {
+			return err
+		}
+	}
+
+	tokens, err := backfillTokens(ctx, cfg, *tokenList)
+	if err != nil {
+		return err
+	}
+
+	client, session := newAngelSession(cfg)
+	if err := session.Ensure(); err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
+
+	clickhouse, err := db.NewClickHouseDB(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to ClickHouse: %v", err)
+	}
+
+	var failed int
+	for _, t := range tokens {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		count, err := backfillInstrument(ctx, client, session, clickhouse, t, *interval, start, end)
+		if err != nil {
+			log.Printf("Backfill of %s %s failed: %v", t.exchange, t.token, err)
+			failed++
+			continue
+		}
+		log.Printf("Backfilled %d %s candles for %s %s", count, *interval, t.exchange, t.token)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tokens failed", failed, len(tokens))
+	}
+	return nil
+}
+
+// backfillInstrument fetches and stores the candles of one instrument
+func backfillInstrument(ctx context.Context, client *angel.Client, session *angel.Session, clickhouse *db.ClickHouseDB,
+	t backfillToken, interval string, start, end time.Time) (int, error) {
+	segment, ok := angel.SegmentForExchange(t.exchange)
+	if !ok {
+		return 0, fmt.Errorf("no historical data segment for exchange %s", t.exchange)
+	}
+
+	// Long backfills can outlive the JWT
+	if err := session.Ensure(); err != nil {
+		return 0, err
+	}
+
+	candles, err := client.Candles(ctx, session.JwtToken(), angel.CandleRequest{
+		Exchange: segment,
+		Token:    t.token,
+		Interval: interval,
+		From:     start,
+		To:       end,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	insertedAt := time.Now()
+	exchangeType := uint8(models.ExchangeMap[t.exchange])
+	rows := make([]models.Candle, len(candles))
+	for i, candle := range candles {
+		rows[i] = models.Candle{
+			Exchange:   exchangeType,
+			Token:      t.token,
+			Interval:   interval,
+			Timestamp:  candle.Timestamp,
+			Open:       candle.Open,
+			High:       candle.High,
+			Low:        candle.Low,
+			Close:      candle.Close,
+			Volume:     candle.Volume,
+			InsertedAt: insertedAt,
+		}
+	}
+
+	if err := clickhouse.InsertCandles(ctx, rows); err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// parseBackfillTime parses a date or date and time in IST. A date alone is
+// the start of the day, or its last minute when endOfDay is set, so that a
+// date-only -to includes that day.
+func parseBackfillTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, angel.IST); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, angel.IST); err == nil {
+		if endOfDay {
+			t = t.Add(24*time.Hour - time.Minute)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use YYYY-MM-DD or \"YYYY-MM-DD HH:MM\"", value)
+}
+
+// backfillTokens returns the tokens from the -tokens flag, or every token in
+// config/tokens.json regardless of its subscription mode
+func backfillTokens(ctx context.Context, cfg *config.Config, list string) ([]backfillToken, error) {
+	var tokens []backfillToken
+	if list != "" {
+		for _, entry := range strings.Split(list, ",") {
+			exchange, token, found := strings.Cut(strings.TrimSpace(entry), ":")
+			if !found || token == "" {
+				return nil, fmt.Errorf("invalid token %q: expected EXCHANGE:TOKEN", entry)
+			}
+			if _, exists := models.ExchangeMap[exchange]; !exists {
+				return nil, fmt.Errorf("unknown exchange %s in %q", exchange, entry)
+			}
+			tokens = append(tokens, backfillToken{exchange: exchange, token: token})
+		}
+		return tokens, nil
+	}
+
+	modeTokens, err := loadTokenConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	exchangeNames := make(map[int]string, len(models.ExchangeMap))
+	for name, exchangeType := range models.ExchangeMap {
+		exchangeNames[exchangeType] = name
+	}
+
+	seen := make(map[backfillToken]bool)
+	for _, exchangeTokens := range modeTokens {
+		for exchangeType, list := range exchangeTokens {
+			for _, token := range list {
+				t := backfillToken{exchange: exchangeNames[exchangeType], token: token}
+				if !seen[t] {
+					seen[t] = true
+					tokens = append(tokens, t)
+				}
+			}
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].exchange != tokens[j].exchange {
+			return tokens[i].exchange < tokens[j].exchange
+		}
+		return tokens[i].token < tokens[j].token
+	})
+	return tokens, nil
+}
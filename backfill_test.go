@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"angelone_clickhouse/angel"
+)
+
+func TestParseBackfillTime(t *testing.T) {
+	tests := []struct {
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"2025-01-10", false, time.Date(2025, 1, 10, 0, 0, 0, 0, angel.IST)},
+		{"2025-01-10", true, time.Date(2025, 1, 10, 23, 59, 0, 0, angel.IST)},
+		{"2025-01-10 15:30", false, time.Date(2025, 1, 10, 15, 30, 0, 0, angel.IST)},
+		{"2025-01-10 15:30", true, time.Date(2025, 1, 10, 15, 30, 0, 0, angel.IST)},
+	}
+	for _, tt := range tests {
+		got, err := parseBackfillTime(tt.value, tt.endOfDay)
+		if err != nil {
+			t.Errorf("parseBackfillTime(%q, %v): %v", tt.value, tt.endOfDay, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseBackfillTime(%q, %v) = %v, want %v", tt.value, tt.endOfDay, got, tt.want)
+		}
+	}
+
+	if _, err := parseBackfillTime("10/01/2025", false); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+
+	// -from and -to on the same date cover the whole trading day
+	from, _ := parseBackfillTime("2025-01-10", false)
+	to, _ := parseBackfillTime("2025-01-10", true)
+	session := time.Date(2025, 1, 10, 15, 29, 0, 0, angel.IST)
+	if session.Before(from) || session.After(to) {
+		t.Errorf("range %v to %v does not include the close at %v", from, to, session)
+	}
+}
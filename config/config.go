@@ -1,11 +1,21 @@
 package config
 
 import (
+    "fmt"
+    "math"
+    "net/url"
     "os"
     "strconv"
+    "strings"
     "time"
 )
 
+const (
+    DefaultAngelBaseURL      = "https://apiconnect.angelbroking.com"
+    DefaultAngelWebSocketURL = "wss://smartapisocket.angelone.in/smart-stream"
+    DefaultScripMasterURL    = "https://margincalculator.angelbroking.com/OpenAPI_File/files/OpenAPIScripMaster.json"
+)
+
 type Config struct {
     App struct {
         Environment  string
@@ -13,6 +23,7 @@ type Config struct {
         NumWorkers  int
         BufferSize  int
         BatchSize   int
+        FlushInterval time.Duration
         TimeoutSecs int
     }
 
@@ -36,6 +47,35 @@ type Config struct {
         RequestTimeout time.Duration
     }
 
+    AngelOne struct {
+        // Base URL of the SmartAPI REST endpoints
+        BaseURL string
+        // SmartStream WebSocket URL
+        WebSocketURL string
+        // Timeout of each REST request
+        RequestTimeout time.Duration
+        // Optional encrypted session cache reused across restarts
+        SessionFile string
+        SessionKey  string
+        // Instrument master download URL, empty to only read ScripMasterFile
+        ScripMasterURL  string
+        ScripMasterFile string
+        // Time of day in IST, as an offset from midnight, at which a new
+        // scrip master is published and the instruments are refreshed
+        ScripMasterRefreshAt time.Duration
+    }
+
+    WebSocket struct {
+        PongTimeout            time.Duration
+        MaxTokensPerConnection int
+        MaxConnections         int
+    }
+
+    Feed struct {
+        // Divisors for raw feed prices keyed by exchange name, e.g. CDE_FO
+        PriceDivisors map[string]float64
+    }
+
     Metrics struct {
         Prefix        string
         EnableDebug   bool
@@ -52,7 +92,14 @@ func Load() (*Config, error) {
     cfg.App.NumWorkers = getEnvAsIntOrDefault("NUM_WORKERS", 5)
     cfg.App.BufferSize = getEnvAsIntOrDefault("BUFFER_SIZE", 1000)
     cfg.App.BatchSize = getEnvAsIntOrDefault("BATCH_SIZE", 1000)
+    cfg.App.FlushInterval = time.Duration(getEnvAsIntOrDefault("FLUSH_INTERVAL", 5)) * time.Second
     cfg.App.TimeoutSecs = getEnvAsIntOrDefault("TIMEOUT_SECS", 30)
+    if cfg.App.BatchSize <= 0 {
+        return nil, fmt.Errorf("invalid BATCH_SIZE %d: must be positive", cfg.App.BatchSize)
+    }
+    if cfg.App.FlushInterval <= 0 {
+        return nil, fmt.Errorf("invalid FLUSH_INTERVAL %v: must be positive", cfg.App.FlushInterval)
+    }
 
     // ClickHouse settings
     cfg.ClickHouse.Host = getEnvOrDefault("CLICKHOUSE_HOST", "localhost")
@@ -66,6 +113,54 @@ func Load() (*Config, error) {
     cfg.ClickHouse.QueryTimeout = time.Duration(getEnvAsIntOrDefault("CLICKHOUSE_QUERY_TIMEOUT_SECS", 30)) * time.Second
     cfg.ClickHouse.Debug = getEnvOrDefault("APP_ENV", "production") != "production"
 
+    // AngelOne endpoints
+    cfg.AngelOne.BaseURL = strings.TrimRight(getEnvOrDefault("ANGEL_API_BASE_URL", DefaultAngelBaseURL), "/")
+    cfg.AngelOne.WebSocketURL = getEnvOrDefault("ANGEL_WS_URL", DefaultAngelWebSocketURL)
+    cfg.AngelOne.RequestTimeout = time.Duration(getEnvAsIntOrDefault("ANGEL_REQUEST_TIMEOUT_SECS", 10)) * time.Second
+    cfg.AngelOne.SessionFile = os.Getenv("ANGEL_SESSION_FILE")
+    cfg.AngelOne.SessionKey = os.Getenv("ANGEL_SESSION_KEY")
+    if cfg.AngelOne.SessionFile != "" && cfg.AngelOne.SessionKey == "" {
+        return nil, fmt.Errorf("ANGEL_SESSION_KEY is required when ANGEL_SESSION_FILE is set")
+    }
+    cfg.AngelOne.ScripMasterURL = DefaultScripMasterURL
+    if value, ok := os.LookupEnv("SCRIP_MASTER_URL"); ok {
+        cfg.AngelOne.ScripMasterURL = value
+    }
+    cfg.AngelOne.ScripMasterFile = getEnvOrDefault("SCRIP_MASTER_FILE", "scripmaster.json")
+    refreshAt, err := time.Parse("15:04", getEnvOrDefault("SCRIP_MASTER_REFRESH_TIME", "08:30"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid SCRIP_MASTER_REFRESH_TIME: expected HH:MM")
+    }
+    cfg.AngelOne.ScripMasterRefreshAt = time.Duration(refreshAt.Hour())*time.Hour + time.Duration(refreshAt.Minute())*time.Minute
+    if cfg.AngelOne.ScripMasterURL != "" {
+        if err := validateURL("SCRIP_MASTER_URL", cfg.AngelOne.ScripMasterURL, "http", "https"); err != nil {
+            return nil, err
+        }
+    }
+    if err := validateURL("ANGEL_API_BASE_URL", cfg.AngelOne.BaseURL, "http", "https"); err != nil {
+        return nil, err
+    }
+    if err := validateURL("ANGEL_WS_URL", cfg.AngelOne.WebSocketURL, "ws", "wss"); err != nil {
+        return nil, err
+    }
+
+    // WebSocket settings
+    cfg.WebSocket.PongTimeout = time.Duration(getEnvAsIntOrDefault("WS_PONG_TIMEOUT_SECS", 30)) * time.Second
+    // The client pings every 10 seconds (ws.HeartbeatInterval); a shorter
+    // timeout would close every connection before its first pong
+    if cfg.WebSocket.PongTimeout <= 10*time.Second {
+        return nil, fmt.Errorf("invalid WS_PONG_TIMEOUT_SECS %v: must be longer than the 10s heartbeat interval", cfg.WebSocket.PongTimeout)
+    }
+    cfg.WebSocket.MaxTokensPerConnection = getEnvAsIntOrDefault("WS_MAX_TOKENS_PER_CONNECTION", 1000)
+    cfg.WebSocket.MaxConnections = getEnvAsIntOrDefault("WS_MAX_CONNECTIONS", 3)
+
+    // Feed settings
+    divisors, err := getEnvAsFloatMap("PRICE_DIVISORS")
+    if err != nil {
+        return nil, err
+    }
+    cfg.Feed.PriceDivisors = divisors
+
     return cfg, nil
 }
 
@@ -84,3 +179,44 @@ func getEnvAsIntOrDefault(key string, defaultValue int) int {
     }
     return defaultValue
 }
+
+// getEnvAsFloatMap parses a comma separated list of KEY=value pairs, e.g. "CDE_FO=10000000,MCX_FO=100"
+func getEnvAsFloatMap(key string) (map[string]float64, error) {
+    result := make(map[string]float64)
+    value := os.Getenv(key)
+    if value == "" {
+        return result, nil
+    }
+
+    for _, pair := range strings.Split(value, ",") {
+        name, raw, found := strings.Cut(strings.TrimSpace(pair), "=")
+        name = strings.TrimSpace(name)
+        if !found || name == "" {
+            return nil, fmt.Errorf("invalid %s entry %q: expected NAME=value", key, pair)
+        }
+        number, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+        if err != nil || number <= 0 || math.IsInf(number, 0) || math.IsNaN(number) {
+            return nil, fmt.Errorf("invalid %s value for %s: %q", key, name, raw)
+        }
+        result[name] = number
+    }
+
+    return result, nil
+}
+
+// validateURL checks that value is an absolute URL with one of the given schemes
+func validateURL(key, value string, schemes ...string) error {
+    u, err := url.Parse(value)
+    if err != nil {
+        return fmt.Errorf("invalid %s %q: %v", key, value, err)
+    }
+    if u.Host == "" {
+        return fmt.Errorf("invalid %s %q: missing host", key, value)
+    }
+    for _, scheme := range schemes {
+        if u.Scheme == scheme {
+            return nil
+        }
+    }
+    return fmt.Errorf("invalid %s %q: scheme must be one of %s", key, value, strings.Join(schemes, ", "))
+}
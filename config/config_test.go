@@ -0,0 +1,81 @@
+package config
+
+import "testing"
+
+func TestLoadRejectsNonPositiveBatchSettings(t *testing.T) {
+    tests := map[string]string{
+        "BATCH_SIZE":     "0",
+        "FLUSH_INTERVAL": "-1",
+    }
+    for key, value := range tests {
+        t.Run(key, func(t *testing.T) {
+            t.Setenv(key, value)
+            if _, err := Load(); err == nil {
+                t.Errorf("%s=%s: expected an error", key, value)
+            }
+        })
+    }
+}
+
+func TestLoadDefaults(t *testing.T) {
+    cfg, err := Load()
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if cfg.App.BatchSize != 1000 || cfg.App.FlushInterval.Seconds() != 5 {
+        t.Errorf("batch size %d, flush interval %v; want 1000 and 5s", cfg.App.BatchSize, cfg.App.FlushInterval)
+    }
+}
+
+func TestLoadRejectsPongTimeoutWithinHeartbeat(t *testing.T) {
+    for _, value := range []string{"0", "5", "10"} {
+        t.Setenv("WS_PONG_TIMEOUT_SECS", value)
+        if _, err := Load(); err == nil {
+            t.Errorf("WS_PONG_TIMEOUT_SECS=%s: expected an error", value)
+        }
+    }
+
+    t.Setenv("WS_PONG_TIMEOUT_SECS", "11")
+    if _, err := Load(); err != nil {
+        t.Errorf("WS_PONG_TIMEOUT_SECS=11: %v", err)
+    }
+}
+
+func TestGetEnvAsFloatMap(t *testing.T) {
+    t.Setenv("PRICE_DIVISORS", " CDE_FO = 10000000 ,MCX_FO=100")
+    divisors, err := getEnvAsFloatMap("PRICE_DIVISORS")
+    if err != nil {
+        t.Fatalf("getEnvAsFloatMap: %v", err)
+    }
+    if len(divisors) != 2 || divisors["CDE_FO"] != 1e7 || divisors["MCX_FO"] != 100 {
+        t.Errorf("divisors = %v, want CDE_FO=1e7 and MCX_FO=100", divisors)
+    }
+
+    t.Setenv("PRICE_DIVISORS", "")
+    if divisors, err := getEnvAsFloatMap("PRICE_DIVISORS"); err != nil || len(divisors) != 0 {
+        t.Errorf("unset: got %v, %v; want an empty map", divisors, err)
+    }
+}
+
+func TestGetEnvAsFloatMapRejectsMalformedEntries(t *testing.T) {
+    for _, value := range []string{
+        "CDE_FO",
+        "CDE_FO:100",
+        "=100",
+        "CDE_FO=",
+        "CDE_FO=abc",
+        "CDE_FO=0",
+        "CDE_FO=-100",
+        "CDE_FO=NaN",
+        "CDE_FO=Inf",
+        "NSE_CM=100,CDE_FO",
+    } {
+        t.Setenv("PRICE_DIVISORS", value)
+        if divisors, err := getEnvAsFloatMap("PRICE_DIVISORS"); err == nil {
+            t.Errorf("PRICE_DIVISORS=%q: got %v, expected an error", value, divisors)
+        }
+        if _, err := Load(); err == nil {
+            t.Errorf("PRICE_DIVISORS=%q: Load accepted it", value)
+        }
+    }
+}
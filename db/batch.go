@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"angelone_clickhouse/models"
+)
+
+// BatchWriter buffers ticks and writes them to angelone_market_data in
+// columnar batches, flushing when the buffer reaches batchSize or every
+// flushInterval. A batch that fails is retried unchanged on the next flush,
+// so its deduplication token matches and a partial earlier write is not
+// stored twice.
+type BatchWriter struct {
+	*flushLoop[models.MarketTick]
+}
+
+func (db *ClickHouseDB) NewBatchWriter(batchSize int, flushInterval time.Duration) *BatchWriter {
+	return &BatchWriter{newFlushLoop("ticks", batchSize, flushInterval, db.insertTickColumns)}
+}
+
+// Write queues one tick, or returns ErrBufferFull when ClickHouse has fallen
+// too far behind
+func (w *BatchWriter) Write(tick models.MarketTick) error {
+	return w.add(tick)
+}
+
+func (db *ClickHouseDB) insertTickColumns(ctx context.Context, ticks []models.MarketTick) error {
+	ctx, cancel := context.WithTimeout(ctx, db.config.ClickHouse.QueryTimeout)
+	defer cancel()
+
+	batch, err := db.conn.PrepareBatch(withDedupToken(ctx, ticks), "INSERT INTO angelone_market_data ("+tickColumns+")")
+	if err != nil {
+		return fmt.Errorf("error preparing tick batch: %v", err)
+	}
+
+	for i, column := range tickColumnValues(ticks) {
+		if err := batch.Column(i).Append(column); err != nil {
+			batch.Abort()
+			return fmt.Errorf("error appending tick column %d: %v", i, err)
+		}
+	}
+
+	return batch.Send()
+}
+
+// tickColumnValues returns one slice per column, in the order of tickColumns
+func tickColumnValues(ticks []models.MarketTick) []interface{} {
+	n := len(ticks)
+	var (
+		exchange           = make([]uint8, n)
+		token              = make([]string, n)
+		timestamp          = make([]time.Time, n)
+		lastPrice          = make([]float64, n)
+		openPrice          = make([]float64, n)
+		highPrice          = make([]float64, n)
+		lowPrice           = make([]float64, n)
+		closePrice         = make([]float64, n)
+		volume             = make([]float64, n)
+		exchangeTimestamp  = make([]time.Time, n)
+		sequenceNumber     = make([]int64, n)
+		subscriptionMode   = make([]uint8, n)
+		lastTradedQuantity = make([]int64, n)
+		averageTradedPrice = make([]float64, n)
+		totalBuyQuantity   = make([]float64, n)
+		totalSellQuantity  = make([]float64, n)
+		lastTradedTime     = make([]time.Time, n)
+		openInterest       = make([]int64, n)
+		openInterestChange = make([]float64, n)
+		bestBuyPrices      = make([][]float64, n)
+		bestBuyQuantities  = make([][]int64, n)
+		bestBuyOrders      = make([][]uint16, n)
+		bestSellPrices     = make([][]float64, n)
+		bestSellQuantities = make([][]int64, n)
+		bestSellOrders     = make([][]uint16, n)
+		upperCircuitLimit  = make([]float64, n)
+		lowerCircuitLimit  = make([]float64, n)
+		fiftyTwoWeekHigh   = make([]float64, n)
+		fiftyTwoWeekLow    = make([]float64, n)
+	)
+
+	for i := range ticks {
+		tick := &ticks[i]
+		exchange[i] = tick.Exchange
+		token[i] = tick.Symbol
+		timestamp[i] = tick.Timestamp
+		lastPrice[i] = tick.LastPrice
+		openPrice[i] = tick.OpenPrice
+		highPrice[i] = tick.HighPrice
+		lowPrice[i] = tick.LowPrice
+		closePrice[i] = tick.ClosePrice
+		volume[i] = tick.Volume
+		exchangeTimestamp[i] = tick.ExchangeTimestamp
+		sequenceNumber[i] = tick.SequenceNumber
+		subscriptionMode[i] = tick.SubscriptionMode
+		lastTradedQuantity[i] = tick.LastTradedQuantity
+		averageTradedPrice[i] = tick.AverageTradedPrice
+		totalBuyQuantity[i] = tick.TotalBuyQuantity
+		totalSellQuantity[i] = tick.TotalSellQuantity
+		lastTradedTime[i] = tick.LastTradedTime
+		openInterest[i] = tick.OpenInterest
+		openInterestChange[i] = tick.OpenInterestChange
+		bestBuyPrices[i] = tick.BestBuyPrices
+		bestBuyQuantities[i] = tick.BestBuyQuantities
+		bestBuyOrders[i] = tick.BestBuyOrders
+		bestSellPrices[i] = tick.BestSellPrices
+		bestSellQuantities[i] = tick.BestSellQuantities
+		bestSellOrders[i] = tick.BestSellOrders
+		upperCircuitLimit[i] = tick.UpperCircuitLimit
+		lowerCircuitLimit[i] = tick.LowerCircuitLimit
+		fiftyTwoWeekHigh[i] = tick.FiftyTwoWeekHigh
+		fiftyTwoWeekLow[i] = tick.FiftyTwoWeekLow
+	}
+
+	return []interface{}{
+		exchange, token, timestamp, lastPrice,
+		openPrice, highPrice, lowPrice,
+		closePrice, volume,
+		exchangeTimestamp, sequenceNumber, subscriptionMode,
+		lastTradedQuantity, averageTradedPrice,
+		totalBuyQuantity, totalSellQuantity,
+		lastTradedTime, openInterest, openInterestChange,
+		bestBuyPrices, bestBuyQuantities, bestBuyOrders,
+		bestSellPrices, bestSellQuantities, bestSellOrders,
+		upperCircuitLimit, lowerCircuitLimit,
+		fiftyTwoWeekHigh, fiftyTwoWeekLow,
+	}
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/models"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+var errSendFailed = errors.New("send failed")
+
+func (c *fakeConn) PrepareBatch(ctx context.Context, query string, opts ...driver.PrepareBatchOption) (driver.Batch, error) {
+	return &fakeBatch{conn: c, columns: make(map[int]any)}, nil
+}
+
+// batches returns the columns, or the rows of a batch built with
+// AppendStruct, of every batch sent so far
+func (c *fakeConn) batches() [][]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]any(nil), c.sends...)
+}
+
+type fakeBatch struct {
+	driver.Batch
+	conn    *fakeConn
+	columns map[int]any
+	rows    []any
+}
+
+func (b *fakeBatch) Column(i int) driver.BatchColumn { return fakeColumn{batch: b, index: i} }
+
+func (b *fakeBatch) AppendStruct(v any) error {
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	if b.conn.failAppends {
+		return errors.New("append failed")
+	}
+	b.rows = append(b.rows, reflect.ValueOf(v).Elem().Interface())
+	return nil
+}
+
+func (b *fakeBatch) Abort() error {
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	b.conn.aborts++
+	return nil
+}
+
+func (b *fakeBatch) Send() error {
+	sent := b.rows
+	if len(b.columns) > 0 {
+		sent = make([]any, len(b.columns))
+		for i, column := range b.columns {
+			sent[i] = column
+		}
+	}
+
+	b.conn.mu.Lock()
+	defer b.conn.mu.Unlock()
+	b.conn.sends = append(b.conn.sends, sent)
+	if b.conn.failSends > 0 {
+		b.conn.failSends--
+		return errSendFailed
+	}
+	return nil
+}
+
+type fakeColumn struct {
+	driver.BatchColumn
+	batch *fakeBatch
+	index int
+}
+
+func (c fakeColumn) Append(v any) error {
+	c.batch.columns[c.index] = v
+	return nil
+}
+
+// sequenceNumbers returns the sequence_number column of a sent batch
+func sequenceNumbers(columns []any) []int64 {
+	return columns[columnIndex("sequence_number")].([]int64)
+}
+
+func columnIndex(name string) int {
+	for i, column := range strings.Split(tickColumns, ",") {
+		if strings.TrimSpace(column) == name {
+			return i
+		}
+	}
+	panic("no column " + name)
+}
+
+// waitForBatches waits until at least n batches have been sent
+func waitForBatches(t *testing.T, conn *fakeConn, n int) [][]any {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if batches := conn.batches(); len(batches) >= n {
+			return batches
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d batches, got %d", n, len(conn.batches()))
+	return nil
+}
+
+// newIdleWriter returns a BatchWriter without its flush loop, so only
+// explicit Flush calls send
+func newIdleWriter(db *ClickHouseDB, batchSize int) *BatchWriter {
+	return &BatchWriter{&flushLoop[models.MarketTick]{
+		what:      "ticks",
+		batchSize: batchSize,
+		send:      db.insertTickColumns,
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}}
+}
+
+func TestBatchWriterFlushesFullBatch(t *testing.T) {
+	conn := &fakeConn{}
+	w := newTestDB(conn).NewBatchWriter(3, time.Hour)
+	defer w.Close()
+
+	for _, tick := range testTicks(1, 2, 3) {
+		if err := w.Write(tick); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	batches := waitForBatches(t, conn, 1)
+	if got := sequenceNumbers(batches[0]); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("flushed sequence numbers %v, want [1 2 3]", got)
+	}
+}
+
+func TestBatchWriterFlushesOnInterval(t *testing.T) {
+	conn := &fakeConn{}
+	w := newTestDB(conn).NewBatchWriter(100, 20*time.Millisecond)
+	defer w.Close()
+
+	if err := w.Write(testTicks(1)[0]); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	batches := waitForBatches(t, conn, 1)
+	if got := sequenceNumbers(batches[0]); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("flushed sequence numbers %v, want [1]", got)
+	}
+}
+
+func TestBatchWriterRetriesFailedBatchUnchanged(t *testing.T) {
+	conn := &fakeConn{failSends: 1}
+	w := newIdleWriter(newTestDB(conn), 100)
+
+	for _, tick := range testTicks(1, 2) {
+		w.Write(tick)
+	}
+	if err := w.Flush(context.Background()); err == nil {
+		t.Fatal("expected the first flush to fail")
+	}
+
+	// Ticks queued after the failure go in a batch of their own
+	w.Write(testTicks(3)[0])
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	batches := conn.batches()
+	if len(batches) != 3 {
+		t.Fatalf("sent %d batches, want 3", len(batches))
+	}
+	if !reflect.DeepEqual(batches[1], batches[0]) {
+		t.Errorf("retried batch differs from the failed one:\n%v\n%v", batches[1], batches[0])
+	}
+	if got := sequenceNumbers(batches[2]); !reflect.DeepEqual(got, []int64{3}) {
+		t.Errorf("next batch sequence numbers %v, want [3]", got)
+	}
+}
+
+func TestBatchWriterRejectsTicksWhenFull(t *testing.T) {
+	w := newIdleWriter(newTestDB(&fakeConn{}), 2)
+
+	for i := 0; i < maxBufferedBatches*2; i++ {
+		if err := w.Write(testTicks(int64(i))[0]); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+	if err := w.Write(testTicks(99)[0]); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Write on a full buffer = %v, want ErrBufferFull", err)
+	}
+}
+
+func TestTickColumnValuesMatchTickColumns(t *testing.T) {
+	// Give every field a distinct value so a swapped column shows up
+	var tick models.MarketTick
+	v := reflect.ValueOf(&tick).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(fmt.Sprintf("v%d", i))
+		case reflect.Uint8, reflect.Uint16:
+			field.SetUint(uint64(i + 1))
+		case reflect.Int64:
+			field.SetInt(int64(i + 1))
+		case reflect.Float64:
+			field.SetFloat(float64(i + 1))
+		case reflect.Slice:
+			field.Set(reflect.Append(reflect.MakeSlice(field.Type(), 0, 1), reflect.ValueOf(i+1).Convert(field.Type().Elem())))
+		case reflect.Struct:
+			field.Set(reflect.ValueOf(time.Unix(int64(i+1), 0)))
+		}
+	}
+
+	byColumn := make(map[string]any)
+	for i := 0; i < v.NumField(); i++ {
+		if name := v.Type().Field(i).Tag.Get("ch"); name != "" {
+			byColumn[name] = v.Field(i).Interface()
+		}
+	}
+
+	columns := strings.Split(tickColumns, ",")
+	values := tickColumnValues([]models.MarketTick{tick})
+	if len(values) != len(columns) {
+		t.Fatalf("%d column values for %d columns", len(values), len(columns))
+	}
+	for i, column := range columns {
+		name := strings.TrimSpace(column)
+		want, ok := byColumn[name]
+		if !ok {
+			t.Errorf("column %s has no MarketTick field", name)
+			continue
+		}
+		if got := reflect.ValueOf(values[i]).Index(0).Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("column %d (%s) = %v, want %v", i, name, got, want)
+		}
+	}
+}
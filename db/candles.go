@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"angelone_clickhouse/models"
+)
+
+// InsertCandles writes one batch of candles
+func (db *ClickHouseDB) InsertCandles(ctx context.Context, candles []models.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	batch, err := db.conn.PrepareBatch(ctx, "INSERT INTO angelone_candles")
+	if err != nil {
+		return fmt.Errorf("failed to prepare candles batch: %v", err)
+	}
+
+	for i := range candles {
+		if err := batch.AppendStruct(&candles[i]); err != nil {
+			batch.Abort()
+			return fmt.Errorf("failed to append candle: %v", err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to insert candles: %v", err)
+	}
+	return nil
+}
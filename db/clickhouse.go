@@ -2,37 +2,27 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"time"
 
 	"angelone_clickhouse/config"
+	"angelone_clickhouse/migrations"
 	"angelone_clickhouse/models"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 )
 
-const createTableSQL = `
-CREATE TABLE IF NOT EXISTS angelone_market_data (
-    token String,
-    timestamp DateTime64(3),
-    last_traded_price Float64,
-    open_price Float64,
-    high_price Float64,
-    low_price Float64,
-    close_price Float64,
-    volume Float64
-) ENGINE = MergeTree()
-ORDER BY timestamp
-`
-
 type ClickHouseDB struct {
 	conn   driver.Conn
 	config *config.Config
 }
 
-func NewClickHouseDB(cfg *config.Config) (*ClickHouseDB, error) {
+// Open connects to ClickHouse without checking the schema version
+func Open(cfg *config.Config) (*ClickHouseDB, error) {
 	opts := &clickhouse.Options{
 		Addr: []string{fmt.Sprintf("%s:%d", cfg.ClickHouse.Host, cfg.ClickHouse.Port)},
 		Auth: clickhouse.Auth{
@@ -61,61 +51,89 @@ func NewClickHouseDB(cfg *config.Config) (*ClickHouseDB, error) {
 		return nil, fmt.Errorf("failed to connect to ClickHouse: %v", err)
 	}
 
-	db := &ClickHouseDB{
+	return &ClickHouseDB{
 		conn:   conn,
 		config: cfg,
+	}, nil
+}
+
+// NewClickHouseDB connects and refuses to continue unless the schema is at
+// the version this build expects. Apply migrations with `migrate up`.
+func NewClickHouseDB(cfg *config.Config) (*ClickHouseDB, error) {
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := db.createTable(); err != nil {
+	if err := db.Migrator().Check(context.Background()); err != nil {
+		db.conn.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func (db *ClickHouseDB) createTable() error {
-	return db.conn.Exec(context.Background(), createTableSQL)
+// Migrator returns the schema migrator for this database
+func (db *ClickHouseDB) Migrator() *migrations.Migrator {
+	return migrations.New(db.conn, migrations.Params{
+		Database: db.config.ClickHouse.Database,
+		User:     db.config.ClickHouse.User,
+		Password: db.config.ClickHouse.Password,
+	})
 }
 
-func (db *ClickHouseDB) InsertTicks(ctx context.Context, ticks []models.MarketTick) error {
-	batch, err := db.conn.PrepareBatch(ctx, "INSERT INTO market_ticks")
-	if err != nil {
-		return err
-	}
+// tickColumns are the angelone_market_data columns written by BatchWriter and
+// read by QueryTicks, in the order of tickColumnValues
+const tickColumns = `
+            exchange, token, timestamp, last_traded_price, 
+            open_price, high_price, low_price, 
+            close_price, volume,
+            exchange_timestamp, sequence_number, subscription_mode,
+            last_traded_quantity, average_traded_price,
+            total_buy_quantity, total_sell_quantity,
+            last_traded_time, open_interest, open_interest_change,
+            best_buy_prices, best_buy_quantities, best_buy_orders,
+            best_sell_prices, best_sell_quantities, best_sell_orders,
+            upper_circuit_limit, lower_circuit_limit,
+            week_52_high, week_52_low`
+
+// withDedupToken sets the insert_deduplication_token of the ticks
+func withDedupToken(ctx context.Context, ticks []models.MarketTick) context.Context {
+	return clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"insert_deduplication_token": dedupToken(ticks),
+	}))
+}
 
-	for _, tick := range ticks {
-		err := batch.AppendStruct(&tick)
-		if err != nil {
-			return err
-		}
+// dedupToken identifies the ticks by their natural key (exchange, token,
+// exchange timestamp, sequence number), so a retried batch gets the same token
+// even though its receive times differ
+func dedupToken(ticks []models.MarketTick) string {
+	hash := sha256.New()
+	for i := range ticks {
+		fmt.Fprintf(hash, "%d|%s|%d|%d\n", ticks[i].Exchange, ticks[i].Symbol,
+			ticks[i].ExchangeTimestamp.UnixMilli(), ticks[i].SequenceNumber)
 	}
-
-	return batch.Send()
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
-// Add method for single tick insertion
-func (db *ClickHouseDB) InsertTick(ctx context.Context, tick models.MarketTick) error {
-	ctx, cancel := context.WithTimeout(ctx, db.config.ClickHouse.QueryTimeout)
-	defer cancel()
-
+// QueryTicks returns the ticks of one instrument whose exchange time falls in
+// [from, to), oldest first. It reads with FINAL so a tick delivered more than
+// once is returned once, even before ClickHouse has merged the duplicates.
+func (db *ClickHouseDB) QueryTicks(ctx context.Context, exchange uint8, token string, from, to time.Time) ([]models.MarketTick, error) {
 	query := `
-        INSERT INTO angelone_market_data (
-            token, timestamp, last_traded_price, 
-            open_price, high_price, low_price, 
-            close_price, volume
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        SELECT ` + tickColumns + `
+        FROM angelone_market_data FINAL
+        WHERE exchange = ? AND token = ?
+          AND exchange_timestamp >= ? AND exchange_timestamp < ?
+        ORDER BY exchange_timestamp, sequence_number
+        SETTINGS do_not_merge_across_partitions_select_final = 1
     `
 
-	return db.conn.Exec(ctx, query,
-		tick.Symbol,
-		tick.Timestamp,
-		tick.LastPrice,
-		tick.OpenPrice,
-		tick.HighPrice,
-		tick.LowPrice,
-		tick.ClosePrice,
-		tick.Volume,
-	)
+	var ticks []models.MarketTick
+	if err := db.conn.Select(ctx, &ticks, query, exchange, token, from, to); err != nil {
+		return nil, fmt.Errorf("error querying ticks: %v", err)
+	}
+	return ticks, nil
 }
 
 // Add method to verify data storage
@@ -125,7 +143,7 @@ func (db *ClickHouseDB) VerifyLastInserted(ctx context.Context, symbol string) (
             token, timestamp, last_traded_price, 
             open_price, high_price, low_price, 
             close_price, volume
-        FROM angelone_market_data 
+        FROM angelone_market_data FINAL
         WHERE token = ?
         ORDER BY timestamp DESC 
         LIMIT 1
@@ -161,7 +179,7 @@ func (db *ClickHouseDB) GetDailyStats(ctx context.Context, symbol string) error
             max(high_price) as day_high,
             sum(volume) as total_volume,
             count(*) as tick_count
-        FROM angelone_market_data 
+        FROM angelone_market_data FINAL
         WHERE token = ? 
         GROUP BY token, date
         ORDER BY date DESC
@@ -193,7 +211,7 @@ func (db *ClickHouseDB) VerifyMultipleTokens(ctx context.Context, tokens []strin
             token,
             max(timestamp) as last_update,
             count(*) as tick_count
-        FROM angelone_market_data 
+        FROM angelone_market_data FINAL
         WHERE token IN (?)
         GROUP BY token
     `
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/config"
+	"angelone_clickhouse/models"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeConn records the queries and batches sent to it. Methods not
+// overridden panic through the nil embedded Conn.
+type fakeConn struct {
+	driver.Conn
+	query string
+	args  []any
+
+	mu sync.Mutex
+	// sends holds the columns of every batch sent, failed ones included
+	sends [][]any
+	// failSends is the number of batch sends still to fail
+	failSends int
+	// failAppends makes AppendStruct fail; aborts counts aborted batches
+	failAppends bool
+	aborts      int
+}
+
+func (c *fakeConn) Select(ctx context.Context, dest any, query string, args ...any) error {
+	c.query = query
+	c.args = args
+	return nil
+}
+
+func newTestDB(conn driver.Conn) *ClickHouseDB {
+	cfg := &config.Config{}
+	cfg.ClickHouse.QueryTimeout = time.Second
+	return &ClickHouseDB{conn: conn, config: cfg}
+}
+
+func testTicks(sequence ...int64) []models.MarketTick {
+	start := time.Date(2025, 1, 10, 9, 15, 0, 0, time.UTC)
+	ticks := make([]models.MarketTick, len(sequence))
+	for i, seq := range sequence {
+		ticks[i] = models.MarketTick{
+			Exchange:          models.NSE_CM,
+			Symbol:            "2885",
+			Timestamp:         time.Now(),
+			ExchangeTimestamp: start.Add(time.Duration(seq) * time.Second),
+			SequenceNumber:    seq,
+			LastPrice:         2500 + float64(seq),
+		}
+	}
+	return ticks
+}
+
+func TestDedupToken(t *testing.T) {
+	batch := testTicks(1, 2, 3)
+	token := dedupToken(batch)
+
+	redelivered := testTicks(1, 2, 3)
+	for i := range redelivered {
+		redelivered[i].Timestamp = redelivered[i].Timestamp.Add(time.Minute)
+	}
+	if got := dedupToken(redelivered); got != token {
+		t.Errorf("same ticks received later: token %s, want %s", got, token)
+	}
+
+	otherInstrument := testTicks(1, 2, 3)
+	otherInstrument[0].Symbol = "1594"
+
+	for name, other := range map[string][]models.MarketTick{
+		"another tick":       testTicks(1, 2, 4),
+		"fewer ticks":        testTicks(1, 2),
+		"another order":      testTicks(3, 2, 1),
+		"another instrument": otherInstrument,
+	} {
+		if got := dedupToken(other); got == token {
+			t.Errorf("%s: token %s matches the original batch", name, got)
+		}
+	}
+}
+
+func TestQueryTicksReadsFinalByExchangeTime(t *testing.T) {
+	conn := &fakeConn{}
+	db := newTestDB(conn)
+	from := time.Date(2025, 1, 10, 3, 45, 0, 0, time.UTC)
+	to := from.Add(6 * time.Hour)
+
+	if _, err := db.QueryTicks(context.Background(), models.NSE_CM, "2885", from, to); err != nil {
+		t.Fatalf("QueryTicks: %v", err)
+	}
+
+	query := strings.Join(strings.Fields(conn.query), " ")
+	for _, want := range []string{
+		"SELECT " + strings.Join(strings.Fields(tickColumns), " ") + " FROM angelone_market_data FINAL",
+		"WHERE exchange = ? AND token = ? AND exchange_timestamp >= ? AND exchange_timestamp < ?",
+		"ORDER BY exchange_timestamp, sequence_number",
+		"do_not_merge_across_partitions_select_final = 1",
+	} {
+		if !strings.Contains(query, want) {
+			t.Errorf("query %q does not contain %q", query, want)
+		}
+	}
+
+	wantArgs := []any{uint8(models.NSE_CM), "2885", from, to}
+	if !reflect.DeepEqual(conn.args, wantArgs) {
+		t.Errorf("args = %v, want %v", conn.args, wantArgs)
+	}
+}
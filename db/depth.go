@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"angelone_clickhouse/models"
+)
+
+// DepthWriter buffers order book levels and writes them to ClickHouse in batches,
+// flushing when the buffer reaches batchSize or every flushInterval. A batch
+// that fails is retried unchanged on the next flush, so a ClickHouse outage
+// delays the book instead of leaving gaps in it.
+type DepthWriter struct {
+	*flushLoop[models.DepthLevel]
+}
+
+func (db *ClickHouseDB) NewDepthWriter(batchSize int, flushInterval time.Duration) *DepthWriter {
+	return &DepthWriter{newFlushLoop("depth levels", batchSize, flushInterval, db.insertDepthLevels)}
+}
+
+// Write queues the levels of one snapshot, all or none, or returns
+// ErrBufferFull when ClickHouse has fallen too far behind
+func (w *DepthWriter) Write(levels []models.DepthLevel) error {
+	return w.add(levels...)
+}
+
+func (db *ClickHouseDB) insertDepthLevels(ctx context.Context, levels []models.DepthLevel) error {
+	ctx, cancel := context.WithTimeout(ctx, db.config.ClickHouse.QueryTimeout)
+	defer cancel()
+
+	batch, err := db.conn.PrepareBatch(ctx, "INSERT INTO angelone_market_depth")
+	if err != nil {
+		return fmt.Errorf("error preparing depth batch: %v", err)
+	}
+
+	for i := range levels {
+		if err := batch.AppendStruct(&levels[i]); err != nil {
+			batch.Abort()
+			return fmt.Errorf("error appending depth level: %v", err)
+		}
+	}
+
+	return batch.Send()
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/models"
+)
+
+func testLevels(side string, levels ...uint8) []models.DepthLevel {
+	rows := make([]models.DepthLevel, len(levels))
+	for i, level := range levels {
+		rows[i] = models.DepthLevel{
+			Timestamp: time.Date(2025, 1, 10, 9, 15, 0, 0, time.UTC),
+			Token:     "2885",
+			Exchange:  models.NSE_CM,
+			Side:      side,
+			Level:     level,
+			Price:     2500 - float64(level),
+			Quantity:  int64(100 * level),
+			Orders:    uint16(level),
+		}
+	}
+	return rows
+}
+
+// sentLevels converts the rows of a sent batch back into depth levels
+func sentLevels(rows []any) []models.DepthLevel {
+	levels := make([]models.DepthLevel, len(rows))
+	for i, row := range rows {
+		levels[i] = row.(models.DepthLevel)
+	}
+	return levels
+}
+
+func TestDepthWriterFlushesFullBatch(t *testing.T) {
+	conn := &fakeConn{}
+	w := newTestDB(conn).NewDepthWriter(4, time.Hour)
+	defer w.Close()
+
+	buy, sell := testLevels(models.DepthSideBuy, 1, 2), testLevels(models.DepthSideSell, 1, 2)
+	if err := w.Write(buy); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Write(sell); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	batches := waitForBatches(t, conn, 1)
+	if got, want := sentLevels(batches[0]), append(buy, sell...); !reflect.DeepEqual(got, want) {
+		t.Errorf("flushed %v, want %v", got, want)
+	}
+}
+
+func TestDepthWriterFlushesOnInterval(t *testing.T) {
+	conn := &fakeConn{}
+	w := newTestDB(conn).NewDepthWriter(100, 20*time.Millisecond)
+	defer w.Close()
+
+	levels := testLevels(models.DepthSideBuy, 1)
+	if err := w.Write(levels); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	batches := waitForBatches(t, conn, 1)
+	if got := sentLevels(batches[0]); !reflect.DeepEqual(got, levels) {
+		t.Errorf("flushed %v, want %v", got, levels)
+	}
+}
+
+func TestDepthWriterRetriesAndAbortsFailedBatches(t *testing.T) {
+	conn := &fakeConn{failAppends: true}
+	w := newTestDB(conn).NewDepthWriter(100, time.Hour)
+	defer w.Close()
+
+	var flushes []error
+	w.OnFlush = func(rows int, duration time.Duration, err error) { flushes = append(flushes, err) }
+
+	levels := testLevels(models.DepthSideSell, 1, 2, 3)
+	w.Write(levels)
+	if err := w.Flush(context.Background()); err == nil {
+		t.Fatal("expected the flush to fail")
+	}
+	if conn.aborts != 1 {
+		t.Errorf("aborted %d batches, want 1", conn.aborts)
+	}
+
+	conn.mu.Lock()
+	conn.failAppends = false
+	conn.mu.Unlock()
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	batches := conn.batches()
+	if len(batches) != 1 || !reflect.DeepEqual(sentLevels(batches[0]), levels) {
+		t.Errorf("sent %v, want the failed batch once", batches)
+	}
+	if len(flushes) != 2 || flushes[0] == nil || flushes[1] != nil {
+		t.Errorf("OnFlush errors %v, want one failure then one success", flushes)
+	}
+}
+
+func TestDepthWriterRejectsSnapshotsWhenFull(t *testing.T) {
+	w := &DepthWriter{&flushLoop[models.DepthLevel]{batchSize: 2, flush: make(chan struct{}, 1)}}
+
+	// A snapshot larger than the cap still fits into an empty buffer
+	if err := w.Write(testLevels(models.DepthSideBuy, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21)); err != nil {
+		t.Fatalf("Write into an empty buffer: %v", err)
+	}
+	if err := w.Write(testLevels(models.DepthSideSell, 1)); !errors.Is(err, ErrBufferFull) {
+		t.Errorf("Write on a full buffer = %v, want ErrBufferFull", err)
+	}
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxBufferedBatches bounds the rows held while ClickHouse is unavailable
+const maxBufferedBatches = 10
+
+// ErrBufferFull is returned by the writers when rows arrive faster than they
+// can be flushed
+var ErrBufferFull = errors.New("write buffer is full")
+
+// flushLoop buffers rows and inserts them with send, flushing when the buffer
+// reaches batchSize or every flushInterval. A batch that fails is retried
+// unchanged on the next flush before anything newer is sent. BatchWriter and
+// DepthWriter are built on it.
+type flushLoop[T any] struct {
+	// what names the rows in log and error messages
+	what      string
+	batchSize int
+	send      func(ctx context.Context, rows []T) error
+
+	// OnFlush, if set before the first write, is called after every flush
+	// attempt with the number of rows sent, how long the insert took and
+	// its error
+	OnFlush func(rows int, duration time.Duration, err error)
+
+	mu     sync.Mutex
+	buffer []T
+
+	// flushMu serializes flushes and guards retry, the batch that failed last
+	flushMu sync.Mutex
+	retry   []T
+
+	flush chan struct{}
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newFlushLoop[T any](what string, batchSize int, flushInterval time.Duration, send func(context.Context, []T) error) *flushLoop[T] {
+	f := &flushLoop[T]{
+		what:      what,
+		batchSize: batchSize,
+		send:      send,
+		buffer:    make([]T, 0, batchSize),
+		flush:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	f.wg.Add(1)
+	go f.run(flushInterval)
+
+	return f
+}
+
+func (f *flushLoop[T]) run(flushInterval time.Duration) {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.flush:
+		case <-f.done:
+			return
+		}
+
+		if err := f.Flush(context.Background()); err != nil {
+			log.Printf("Error flushing %s: %v", f.what, err)
+		}
+	}
+}
+
+// add queues rows, all or none; an empty buffer always takes them so a write
+// larger than the cap is not rejected forever. A full batch wakes the flush
+// loop so the caller never blocks on ClickHouse.
+func (f *flushLoop[T]) add(rows ...T) error {
+	f.mu.Lock()
+	if len(f.buffer) > 0 && len(f.buffer)+len(rows) > maxBufferedBatches*f.batchSize {
+		f.mu.Unlock()
+		return ErrBufferFull
+	}
+	f.buffer = append(f.buffer, rows...)
+	full := len(f.buffer) >= f.batchSize
+	f.mu.Unlock()
+
+	if full {
+		select {
+		case f.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush retries the last failed batch, if any, and then writes all buffered rows
+func (f *flushLoop[T]) Flush(ctx context.Context) error {
+	f.flushMu.Lock()
+	defer f.flushMu.Unlock()
+
+	if f.retry != nil {
+		if err := f.insert(ctx, f.retry); err != nil {
+			return err
+		}
+		f.retry = nil
+	}
+
+	f.mu.Lock()
+	if len(f.buffer) == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	rows := f.buffer
+	f.buffer = make([]T, 0, f.batchSize)
+	f.mu.Unlock()
+
+	if err := f.insert(ctx, rows); err != nil {
+		f.retry = rows
+		return err
+	}
+	return nil
+}
+
+// Close stops the flush loop and writes whatever is still buffered
+func (f *flushLoop[T]) Close() error {
+	close(f.done)
+	f.wg.Wait()
+	return f.Flush(context.Background())
+}
+
+// insert sends one batch and reports it to OnFlush
+func (f *flushLoop[T]) insert(ctx context.Context, rows []T) error {
+	start := time.Now()
+	err := f.send(ctx, rows)
+	if f.OnFlush != nil {
+		f.OnFlush(len(rows), time.Since(start), err)
+	}
+	if err != nil {
+		return fmt.Errorf("error sending %d %s: %v", len(rows), f.what, err)
+	}
+	return nil
+}
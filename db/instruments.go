@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"angelone_clickhouse/models"
+)
+
+// RefreshInstruments upserts the instrument master and reloads the dictionary
+// so lookups see the new rows immediately
+func (db *ClickHouseDB) RefreshInstruments(ctx context.Context, instruments []models.Instrument) error {
+	batch, err := db.conn.PrepareBatch(ctx, "INSERT INTO instruments")
+	if err != nil {
+		return fmt.Errorf("failed to prepare instruments batch: %v", err)
+	}
+
+	for i := range instruments {
+		if err := batch.AppendStruct(&instruments[i]); err != nil {
+			batch.Abort()
+			return fmt.Errorf("failed to append instrument %s: %v", instruments[i].Token, err)
+		}
+	}
+
+	if err := batch.Send(); err != nil {
+		return fmt.Errorf("failed to insert instruments: %v", err)
+	}
+
+	if err := db.conn.Exec(ctx, "SYSTEM RELOAD DICTIONARY instruments_dict"); err != nil {
+		return fmt.Errorf("failed to reload instruments dictionary: %v", err)
+	}
+
+	return nil
+}
@@ -15,8 +15,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -25,27 +28,125 @@ import (
 
 type MarketData struct {
 	Token           string  `json:"token"`
+	ExchangeType    uint8   `json:"exchange_type"`
 	LastTradedPrice float64 `json:"last_traded_price"`
 	OpenPrice       float64 `json:"open_price_of_the_day"`
 	HighPrice       float64 `json:"high_price_of_the_day"`
 	LowPrice        float64 `json:"low_price_of_the_day"`
 	ClosedPrice     float64 `json:"closed_price"`
 	Volume          float64 `json:"volume_trade_for_the_day"`
+
+	// Frame metadata; ReceivedAt is stamped when the frame arrives
+	ReceivedAt        time.Time `json:"received_at"`
+	ExchangeTimestamp int64     `json:"exchange_timestamp"`
+	SequenceNumber    int64     `json:"sequence_number"`
+	SubscriptionMode  uint8     `json:"subscription_mode"`
+
+	// Quote fields
+	LastTradedQuantity int64   `json:"last_traded_quantity"`
+	AverageTradedPrice float64 `json:"average_traded_price"`
+	TotalBuyQuantity   float64 `json:"total_buy_quantity"`
+	TotalSellQuantity  float64 `json:"total_sell_quantity"`
+
+	// SnapQuote fields
+	LastTradedTimestamp int64                  `json:"last_traded_timestamp"`
+	OpenInterest        int64                  `json:"open_interest"`
+	OpenInterestChange  float64                `json:"open_interest_change_percentage"`
+	BestFiveBuy         [5]parser.BestFiveData `json:"best_5_buy_data"`
+	BestFiveSell        [5]parser.BestFiveData `json:"best_5_sell_data"`
+	UpperCircuitLimit   float64                `json:"upper_circuit_limit"`
+	LowerCircuitLimit   float64                `json:"lower_circuit_limit"`
+	FiftyTwoWeekHigh    float64                `json:"52_week_high_price"`
+	FiftyTwoWeekLow     float64                `json:"52_week_low_price"`
+}
+
+// bestFiveColumns splits best-five levels into the price, quantity and order arrays stored in ClickHouse
+func bestFiveColumns(exchangeType uint8, levels [5]parser.BestFiveData) ([]float64, []int64, []uint16) {
+	prices := make([]float64, 0, len(levels))
+	quantities := make([]int64, 0, len(levels))
+	orders := make([]uint16, 0, len(levels))
+	for _, level := range levels {
+		if level.Quantity == 0 && level.Price == 0 {
+			continue
+		}
+		prices = append(prices, parser.ScalePrice(exchangeType, level.Price))
+		quantities = append(quantities, level.Quantity)
+		orders = append(orders, level.NumberOfOrders)
+	}
+	return prices, quantities, orders
 }
 
-// Add channel type for data processing
-type MarketDataChannel struct {
-	data       MarketData
-	clickhouse *db.ClickHouseDB
+// depthLevels flattens a depth-20 snapshot into one row per non-empty level
+func depthLevels(depth *parser.DepthData) []models.DepthLevel {
+	timestamp := time.Now()
+	if depth.PacketReceivedTime > 0 {
+		timestamp = time.UnixMilli(depth.PacketReceivedTime)
+	}
+
+	levels := make([]models.DepthLevel, 0, 2*parser.DepthLevels)
+	sides := []struct {
+		name    string
+		entries *[parser.DepthLevels]parser.DepthEntry
+	}{
+		{models.DepthSideBuy, &depth.Buy},
+		{models.DepthSideSell, &depth.Sell},
+	}
+	for _, side := range sides {
+		for i, entry := range side.entries {
+			if entry.Quantity == 0 && entry.Price == 0 {
+				continue
+			}
+			levels = append(levels, models.DepthLevel{
+				Timestamp: timestamp,
+				Token:     depth.Token,
+				Exchange:  depth.ExchangeType,
+				Side:      side.name,
+				Level:     uint8(i + 1),
+				Price:     depth.GetPrice(&entry),
+				Quantity:  int64(entry.Quantity),
+				Orders:    uint16(entry.NumberOfOrders),
+			})
+		}
+	}
+	return levels
 }
 
 func main() {
+	// Load environment variables before reading configuration from them
+	if err := godotenv.Load(); err != nil {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Apply per-exchange price divisors before any frame is decoded
+	if err := applyPriceDivisors(cfg.Feed.PriceDivisors); err != nil {
+		log.Fatalf("Invalid PRICE_DIVISORS: %v", err)
+	}
+
+	// Subcommands run to completion instead of starting the stream
+	if len(os.Args) > 1 {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		switch os.Args[1] {
+		case "backfill":
+			err = runBackfill(ctx, cfg, os.Args[2:])
+		case "migrate":
+			err = runMigrate(ctx, cfg, os.Args[2:])
+		default:
+			log.Fatalf("Unknown command %q, expected backfill or migrate", os.Args[1])
+		}
+		if err != nil {
+			log.Fatalf("%s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// Initialize metrics
 	metricsInstance := metrics.NewMetrics(cfg)
 
@@ -55,33 +156,29 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// Initialize worker pool
-	jobs := make(chan MarketDataChannel, cfg.App.BufferSize)
-	for w := 1; w <= cfg.App.NumWorkers; w++ {
-		go processDataWorker(w, jobs, db, metricsInstance)
-	}
-
 	// Initialize logger
 	if err := utils.InitLogger(); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
 
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-
-	// Create reconnection context
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create reconnection context, cancelled on SIGINT/SIGTERM to drain the WebSocket
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 
+	// Keep the instruments dimension table in sync with the scrip master
+	go refreshInstruments(ctx, cfg, db)
+
+	// One AngelOne session is shared by every connection and reused across reconnects
+	_, session := newAngelSession(cfg)
+	go session.Run(ctx)
+
 	go func() {
 		defer wg.Done()
 		operation := func() error {
-			return runWebSocket(ctx, cfg, metricsInstance)
+			return runWebSocket(ctx, cfg, session, metricsInstance)
 		}
 
 		retry := utils.NewExponentialBackoff()
@@ -115,6 +212,23 @@ func main() {
 	wg.Wait()
 }
 
+// applyPriceDivisors installs the PRICE_DIVISORS overrides, keyed by exchange
+// name, in the parser. Nothing is applied if any exchange is unknown.
+func applyPriceDivisors(divisors map[string]float64) error {
+	exchangeTypes := make(map[string]uint8, len(divisors))
+	for exchange := range divisors {
+		exchangeType, exists := models.ExchangeMap[exchange]
+		if !exists {
+			return fmt.Errorf("unknown exchange %s", exchange)
+		}
+		exchangeTypes[exchange] = uint8(exchangeType)
+	}
+	for exchange, divisor := range divisors {
+		parser.SetPriceDivisor(exchangeTypes[exchange], divisor)
+	}
+	return nil
+}
+
 func processAndStoreData(data MarketData) {
 	// Format output with correct decimal places
 	now := time.Now()
@@ -130,42 +244,81 @@ func processAndStoreData(data MarketData) {
 		data.Volume)
 }
 
-// Update processDataWorker signature and implementation
-func processDataWorker(id int, jobs <-chan MarketDataChannel, db *db.ClickHouseDB, metrics *metrics.Metrics) {
-	for job := range jobs {
-		// Create a MarketTick for ClickHouse storage
-		tick := models.MarketTick{
-			Timestamp:  time.Now(),
-			Symbol:     job.data.Token,
-			LastPrice:  job.data.LastTradedPrice,
-			Volume:     int64(job.data.Volume),
-			OpenPrice:  job.data.OpenPrice,
-			HighPrice:  job.data.HighPrice,
-			LowPrice:   job.data.LowPrice,
-			ClosePrice: job.data.ClosedPrice,
-		}
-
-		// Store tick with retry mechanism
-		if err := job.clickhouse.InsertTick(context.Background(), tick); err != nil {
-			utils.Error(err, "Error storing tick",
+// marketTick converts queued market data into the row stored in ClickHouse
+func marketTick(data MarketData) models.MarketTick {
+	tick := models.MarketTick{
+		Timestamp:  data.ReceivedAt,
+		Exchange:   data.ExchangeType,
+		Symbol:     data.Token,
+		LastPrice:  data.LastTradedPrice,
+		Volume:     data.Volume,
+		OpenPrice:  data.OpenPrice,
+		HighPrice:  data.HighPrice,
+		LowPrice:   data.LowPrice,
+		ClosePrice: data.ClosedPrice,
+
+		SequenceNumber:     data.SequenceNumber,
+		SubscriptionMode:   data.SubscriptionMode,
+		LastTradedQuantity: data.LastTradedQuantity,
+		AverageTradedPrice: data.AverageTradedPrice,
+		TotalBuyQuantity:   data.TotalBuyQuantity,
+		TotalSellQuantity:  data.TotalSellQuantity,
+
+		OpenInterest:       data.OpenInterest,
+		OpenInterestChange: data.OpenInterestChange,
+		UpperCircuitLimit:  data.UpperCircuitLimit,
+		LowerCircuitLimit:  data.LowerCircuitLimit,
+		FiftyTwoWeekHigh:   data.FiftyTwoWeekHigh,
+		FiftyTwoWeekLow:    data.FiftyTwoWeekLow,
+	}
+
+	// The exchange timestamp is part of the dedup key; without one the
+	// receive time keeps the tick distinct
+	tick.ExchangeTimestamp = tick.Timestamp
+	if data.ExchangeTimestamp > 0 {
+		tick.ExchangeTimestamp = time.UnixMilli(data.ExchangeTimestamp)
+	}
+	if data.LastTradedTimestamp > 0 {
+		tick.LastTradedTime = time.Unix(data.LastTradedTimestamp, 0)
+	}
+	tick.BestBuyPrices, tick.BestBuyQuantities, tick.BestBuyOrders = bestFiveColumns(data.ExchangeType, data.BestFiveBuy)
+	tick.BestSellPrices, tick.BestSellQuantities, tick.BestSellOrders = bestFiveColumns(data.ExchangeType, data.BestFiveSell)
+	if len(tick.BestBuyPrices) > 0 {
+		tick.BidPrice = tick.BestBuyPrices[0]
+	}
+	if len(tick.BestSellPrices) > 0 {
+		tick.AskPrice = tick.BestSellPrices[0]
+	}
+	return tick
+}
+
+// processDataWorker converts queued market data into ticks for writer
+func processDataWorker(id int, jobs <-chan MarketData, writer *db.BatchWriter, metrics *metrics.Metrics) {
+	for data := range jobs {
+		tick := marketTick(data)
+
+		// Queue the tick; the writer inserts it with the next batch
+		if err := writer.Write(tick); err != nil {
+			utils.Error(err, "Error queueing tick",
 				"worker_id", id,
-				"token", job.data.Token,
+				"token", data.Token,
 			)
 			metrics.IncrementErrors()
 			continue
 		}
 
-		utils.Logger.Infow("Tick stored",
+		utils.Logger.Infow("Tick queued",
 			"worker_id", id,
-			"token", job.data.Token,
-			"price", job.data.LastTradedPrice,
+			"token", data.Token,
+			"price", data.LastTradedPrice,
 		)
 		metrics.IncrementProcessed()
 	}
 }
 
-// Add loadTokenConfig function
-func loadTokenConfig() (map[int][]string, error) {
+// Add loadTokenConfig function. Tokens are grouped by subscription mode and
+// then by exchange type; tokens without a mode use Quote mode.
+func loadTokenConfig(ctx context.Context, cfg *config.Config) (map[int]map[int][]string, error) {
 	file, err := os.ReadFile("config/tokens.json")
 	if err != nil {
 		return nil, fmt.Errorf("error reading tokens file: %v", err)
@@ -176,31 +329,174 @@ func loadTokenConfig() (map[int][]string, error) {
 		return nil, fmt.Errorf("error parsing tokens json: %v", err)
 	}
 
-	// Group tokens by exchange type
-	exchangeTokens := make(map[int][]string)
+	if err := resolveTokens(ctx, cfg, tokens); err != nil {
+		return nil, err
+	}
+
+	return groupTokens(tokens)
+}
+
+// groupTokens groups resolved tokens by subscription mode and exchange type.
+// Entries without a mode use Quote mode; an unknown mode is an error, as
+// dropping the token would silently leave it unsubscribed.
+func groupTokens(tokens []models.TokenConfig) (map[int]map[int][]string, error) {
+	modeTokens := make(map[int]map[int][]string)
 	for _, token := range tokens {
+		// Entries the scrip master could not resolve were already reported
+		if token.Token == "" {
+			continue
+		}
+
 		exchangeType, exists := models.ExchangeMap[token.Exchange]
 		if !exists {
 			log.Printf("Warning: Unknown exchange type %s for token %s", token.Exchange, token.Token)
 			continue
 		}
-		exchangeTokens[exchangeType] = append(exchangeTokens[exchangeType], token.Token)
+
+		mode := models.QuoteMode
+		if token.Mode != "" {
+			mode, exists = models.ModeMap[strings.ToUpper(token.Mode)]
+			if !exists {
+				return nil, fmt.Errorf("unknown mode %q for token %s", token.Mode, token.Token)
+			}
+		}
+
+		if modeTokens[mode] == nil {
+			modeTokens[mode] = make(map[int][]string)
+		}
+		modeTokens[mode][exchangeType] = append(modeTokens[mode][exchangeType], token.Token)
 	}
 
-	return exchangeTokens, nil
+	return modeTokens, nil
 }
 
-// Update runWebSocket to use configuration consistently
-func runWebSocket(ctx context.Context, cfg *config.Config, metrics *metrics.Metrics) error {
-	// Authenticate with AngelOne
-	authToken, feedToken, err := angel.Authenticate()
-	if err != nil {
-		log.Fatalf("Authentication failed: %v", err)
+func resolveTokens(ctx context.Context, cfg *config.Config, tokens []models.TokenConfig) error {
+	var master *angel.ScripMaster
+	for i := range tokens {
+		token := &tokens[i]
+		if token.Token != "" {
+			continue
+		}
+
+		if master == nil {
+			loader := angel.ScripMasterLoader{
+				URL:       cfg.AngelOne.ScripMasterURL,
+				CacheFile: cfg.AngelOne.ScripMasterFile,
+			}
+			var err error
+			if master, err = loader.Load(ctx); err != nil {
+				return fmt.Errorf("failed to load scrip master: %v", err)
+			}
+			log.Printf("Loaded %d instruments from the scrip master", master.Len())
+		}
+
+		instrument, err := master.Resolve(angel.InstrumentQuery{
+			Exchange:   token.Exchange,
+			Symbol:     token.Symbol,
+			Name:       token.Name,
+			Expiry:     token.Expiry,
+			Strike:     token.Strike,
+			OptionType: token.OptionType,
+		})
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+
+		token.Token = instrument.Token
+		token.Exchange = instrument.Exchange()
+		token.Symbol = instrument.Symbol
 	}
+	return nil
+}
+
+// newAngelSession creates the REST client and the session that shares its tokens
+func newAngelSession(cfg *config.Config) (*angel.Client, *angel.Session) {
+	client := angel.NewClient(cfg.AngelOne.BaseURL, cfg.AngelOne.RequestTimeout)
+	client.Debug = cfg.App.LogLevel == "debug"
+	session := angel.NewSession(client)
+	session.CacheFile = cfg.AngelOne.SessionFile
+	session.CacheKey = cfg.AngelOne.SessionKey
+	return client, session
+}
+
+// refreshInstruments loads the scrip master into the instruments table at
+// startup and then daily at SCRIP_MASTER_REFRESH_TIME, when a new master is
+// published
+func refreshInstruments(ctx context.Context, cfg *config.Config, clickhouse *db.ClickHouseDB) {
+	loader := angel.ScripMasterLoader{
+		URL:         cfg.AngelOne.ScripMasterURL,
+		CacheFile:   cfg.AngelOne.ScripMasterFile,
+		PublishedAt: cfg.AngelOne.ScripMasterRefreshAt,
+	}
+
+	for {
+		master, err := loader.Load(ctx)
+		if err == nil {
+			rows := instrumentRows(master, time.Now())
+			if err = clickhouse.RefreshInstruments(ctx, rows); err == nil {
+				log.Printf("Refreshed %d instruments", len(rows))
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to refresh instruments: %v", err)
+		}
 
-	// Set tokens in environment
-	os.Setenv("ANGEL_AUTH_TOKEN", authToken)
-	os.Setenv("ANGEL_FEED_TOKEN", feedToken)
+		next := angel.NextScripMasterPublish(time.Now(), cfg.AngelOne.ScripMasterRefreshAt)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// instrumentRows converts the scrip master to instruments table rows,
+// skipping segments SmartStream does not serve
+func instrumentRows(master *angel.ScripMaster, updatedAt time.Time) []models.Instrument {
+	instruments := master.Instruments()
+	rows := make([]models.Instrument, 0, len(instruments))
+	for i := range instruments {
+		instrument := &instruments[i]
+		exchangeType, exists := models.ExchangeMap[instrument.Exchange()]
+		if !exists {
+			continue
+		}
+
+		lotSize, err := strconv.Atoi(instrument.LotSize)
+		if err != nil || lotSize < 0 {
+			lotSize = 0
+		}
+		// Date cannot hold the zero time; 1970-01-01 marks instruments without an expiry
+		expiry := instrument.ExpiryDate()
+		if expiry.IsZero() {
+			expiry = time.Unix(0, 0).UTC()
+		}
+
+		rows = append(rows, models.Instrument{
+			Exchange:       uint8(exchangeType),
+			Token:          instrument.Token,
+			Symbol:         instrument.Symbol,
+			Name:           instrument.Name,
+			InstrumentType: instrument.InstrumentType,
+			Expiry:         expiry,
+			Strike:         instrument.StrikePrice(),
+			LotSize:        uint32(lotSize),
+			TickSize:       instrument.TickSizePrice(),
+			UpdatedAt:      updatedAt,
+		})
+	}
+	return rows
+}
+
+// Update runWebSocket to use configuration consistently
+func runWebSocket(ctx context.Context, cfg *config.Config, session *angel.Session, metrics *metrics.Metrics) error {
+	// Reuse the cached session, refreshing or logging in only when needed
+	if err := session.Ensure(); err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
 
 	// Initialize ClickHouse connection using config
 	clickhouse, err := db.NewClickHouseDB(cfg)
@@ -208,38 +504,49 @@ func runWebSocket(ctx context.Context, cfg *config.Config, metrics *metrics.Metr
 		log.Fatalf("Failed to connect to ClickHouse: %v", err)
 	}
 
-	// Initialize WebSocket client with AngelOne headers
-	headers := map[string]string{
-		"Authorization": "Bearer " + authToken,
-		"X-Client-Code": os.Getenv("ANGEL_CLIENT_ID"),
-		"X-Api-Key":     os.Getenv("ANGEL_API_KEY"),
-		"X-Feed-Token":  feedToken,
-		"Accept":        "application/json",
-		"Content-Type":  "application/json",
+	// Initialize WebSocket client with AngelOne headers, read from the session
+	// on every dial so reconnects use refreshed tokens
+	headers := func() map[string]string {
+		return map[string]string{
+			"Authorization": "Bearer " + session.JwtToken(),
+			"X-Client-Code": os.Getenv("ANGEL_CLIENT_ID"),
+			"X-Api-Key":     os.Getenv("ANGEL_API_KEY"),
+			"X-Feed-Token":  session.FeedToken(),
+			"Accept":        "application/json",
+			"Content-Type":  "application/json",
+		}
 	}
 
-	wsClient := ws.NewWebSocketClient("wss://smartapisocket.angelone.in/smart-stream", headers)
-
-	// Buffer for batch inserts
-	tickBuffer := make([]models.MarketTick, 0, 1000)
-
-	// Add configuration parameters
-	const (
-		batchSize     = 1000
-		flushInterval = 5 * time.Second
-	)
-
-	// Create a ticker for regular flushes
-	ticker := time.NewTicker(flushInterval)
-	defer ticker.Stop()
+	// Tokens are sharded across as many connections as the per-connection limit requires
+	wsManager := ws.NewManager(cfg.AngelOne.WebSocketURL, headers())
+	wsManager.HeaderFunc = headers
+	wsManager.MaxTokensPerConnection = cfg.WebSocket.MaxTokensPerConnection
+	wsManager.MaxConnections = cfg.WebSocket.MaxConnections
+	wsManager.PongTimeout = cfg.WebSocket.PongTimeout
+	wsManager.CorrelationID = "ws_test"
+	wsManager.OnStateChange = func(state ws.State) {
+		utils.Logger.Infow("WebSocket state changed", "state", state.String())
+	}
+	wsManager.OnResubscribe = func(tokens int) {
+		utils.Logger.Infow("Subscriptions restored after reconnect", "tokens", tokens)
+		metrics.AddResubscribedTokens(tokens)
+	}
 
+	// Publish connection liveness
 	go func() {
-		for range ticker.C {
-			if len(tickBuffer) > 0 {
-				if err := clickhouse.InsertTicks(context.Background(), tickBuffer); err != nil {
-					log.Printf("Error inserting ticks: %v", err)
+		stateTicker := time.NewTicker(5 * time.Second)
+		defer stateTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stateTicker.C:
+				var tickAge time.Duration
+				if lastTick := wsManager.LastTick(); !lastTick.IsZero() {
+					tickAge = time.Since(lastTick)
 				}
-				tickBuffer = tickBuffer[:0]
+				metrics.SetConnectionState(wsManager.IsConnected(), wsManager.LastPongAge(), tickAge)
 			}
 		}
 	}()
@@ -270,81 +577,154 @@ func runWebSocket(ctx context.Context, cfg *config.Config, metrics *metrics.Metr
 		}
 	}()
 
+	// Ticks are written in columnar batches of BATCH_SIZE, or every FLUSH_INTERVAL
+	tickWriter := clickhouse.NewBatchWriter(cfg.App.BatchSize, cfg.App.FlushInterval)
+	tickWriter.OnFlush = metrics.RecordFlush
+
+	// Order book levels from depth subscriptions are written in their own batches
+	depthWriter := clickhouse.NewDepthWriter(cfg.App.BatchSize, cfg.App.FlushInterval)
+	depthWriter.OnFlush = metrics.RecordDepthFlush
+
 	// Create a buffered channel for market data processing
-	jobs := make(chan MarketDataChannel, cfg.App.BufferSize)
+	jobs := make(chan MarketData, cfg.App.BufferSize)
 
 	// Start worker pool
+	var workers sync.WaitGroup
 	for w := 1; w <= cfg.App.NumWorkers; w++ {
-		go processDataWorker(w, jobs, clickhouse, metrics)
+		workers.Add(1)
+		go func(id int) {
+			defer workers.Done()
+			processDataWorker(id, jobs, tickWriter, metrics)
+		}(w)
 	}
 
+	// Once no more ticks arrive, let the workers drain the queue into the
+	// writers before the final flush, so queued ticks are not lost
+	defer func() {
+		close(jobs)
+		workers.Wait()
+
+		if err := tickWriter.Close(); err != nil {
+			log.Printf("Error flushing ticks on shutdown: %v", err)
+		}
+		if err := depthWriter.Close(); err != nil {
+			log.Printf("Error flushing depth on shutdown: %v", err)
+		}
+	}()
+
 	// Load token configuration
-	exchangeTokens, err := loadTokenConfig()
+	modeTokens, err := loadTokenConfig(ctx, cfg)
 	if err != nil {
 		return fmt.Errorf("failed to load token configuration: %v", err)
 	}
 
-	// Create subscription requests for each exchange type
-	var tokenList []angel.TokenSubscription
-	for exchangeType, tokens := range exchangeTokens {
-		tokenList = append(tokenList, angel.TokenSubscription{
-			ExchangeType: exchangeType,
-			Tokens:      tokens,
-		})
+	// Create one token list per mode, grouped by exchange type
+	modeTokenLists := make(map[int][]angel.TokenSubscription)
+	for mode, exchangeTokens := range modeTokens {
+		for exchangeType, tokens := range exchangeTokens {
+			modeTokenLists[mode] = append(modeTokenLists[mode], angel.TokenSubscription{
+				ExchangeType: exchangeType,
+				Tokens:       tokens,
+			})
+		}
 	}
 
-	// Subscribe to market data
-	subscribeReq := angel.SubscribeRequest{
-		CorrelationID: "ws_test",
-		Action:        models.SubscribeAction,
-		Params: angel.SubscriptionParams{
-			Mode:      models.QuoteMode,
-			TokenList: tokenList,
-		},
+	// Error responses from the server, e.g. invalid token or subscription limit exceeded
+	wsManager.OnError = func(serverErr *ws.ServerError) {
+		utils.Error(serverErr, "WebSocket server error",
+			"code", serverErr.ErrorCode,
+			"correlation_id", serverErr.CorrelationID,
+		)
+		metrics.IncrementServerErrors(serverErr.ErrorCode)
 	}
 
-	// Update message handling for concurrent processing
-	wsClient.OnMessage = func(message []byte) {
-		data, err := parser.ParseBinaryData(message)
-		if err != nil {
-			log.Printf("Error parsing binary data: %v", err)
+	// Decode frames as they arrive and hand them to the writers
+	wsManager.OnTick = tickHandler(jobs, depthWriter, metrics)
+
+	// Register the subscriptions, one request per mode; each connection sends its share on every (re)connect
+	for mode, tokenList := range modeTokenLists {
+		if err := wsManager.Subscribe(mode, tokenList); err != nil {
+			log.Fatalf("Failed to subscribe: %v", err)
+		}
+	}
+
+	// Listen until shutdown; reconnects are handled by each connection
+	wsManager.Listen(ctx)
+
+	return nil
+}
+
+// tickHandler returns the OnTick callback. Depth frames go to depthWriter,
+// other frames are decoded and queued on jobs for the workers; invalid frames
+// are counted by reason and dropped.
+func tickHandler(jobs chan<- MarketData, depthWriter *db.DepthWriter, metrics *metrics.Metrics) func(message []byte) {
+	return func(message []byte) {
+		// Stamp receive time before any decoding or queueing delay
+		receivedAt := time.Now()
+
+		// Depth-20 packets have their own layout and storage
+		if len(message) > 0 && message[0] == models.DepthMode {
+			depth, err := parser.ParseDepthData(message)
+			if err != nil {
+				log.Printf("Skipping invalid depth frame: %v", err)
+				metrics.IncrementInvalidFrames(parser.FrameErrorReason(err))
+				return
+			}
+			if err := depthWriter.Write(depthLevels(depth)); err != nil {
+				log.Printf("Dropping depth snapshot for %s: %v", depth.Token, err)
+				metrics.IncrementErrors()
+			}
+			return
+		}
+
+		// Decode into a pooled MarketData to keep the hot path allocation free
+		data := parser.AcquireMarketData()
+		defer parser.ReleaseMarketData(data)
+		if err := parser.DecodeMarketData(message, data); err != nil {
+			log.Printf("Skipping invalid frame: %v", err)
+			metrics.IncrementInvalidFrames(parser.FrameErrorReason(err))
 			return
 		}
 
 		adjustedData := MarketData{
 			Token:           data.Token,
+			ExchangeType:    data.ExchangeType,
 			LastTradedPrice: data.GetLastTradedPrice(),
 			OpenPrice:       data.GetOpenPrice(),
 			HighPrice:       data.GetHighPrice(),
 			LowPrice:        data.GetLowPrice(),
 			ClosedPrice:     data.GetClosedPrice(),
 			Volume:          float64(data.VolumeTrade),
+
+			ReceivedAt:        receivedAt,
+			ExchangeTimestamp: data.ExchangeTimestamp,
+			SequenceNumber:    data.SequenceNumber,
+			SubscriptionMode:  data.SubscriptionMode,
+
+			LastTradedQuantity: data.LastTradedQuantity,
+			AverageTradedPrice: data.GetAverageTradedPrice(),
+			TotalBuyQuantity:   data.TotalBuyQuantity,
+			TotalSellQuantity:  data.TotalSellQuantity,
+
+			LastTradedTimestamp: data.LastTradedTimestamp,
+			OpenInterest:        data.OpenInterest,
+			OpenInterestChange:  data.OpenInterestChange,
+			BestFiveBuy:         data.BestFiveBuy,
+			BestFiveSell:        data.BestFiveSell,
+			UpperCircuitLimit:   data.GetUpperCircuitLimit(),
+			LowerCircuitLimit:   data.GetLowerCircuitLimit(),
+			FiftyTwoWeekHigh:    data.GetFiftyTwoWeekHigh(),
+			FiftyTwoWeekLow:     data.GetFiftyTwoWeekLow(),
 		}
 
 		// Send to worker pool through channel
 		select {
-		case jobs <- MarketDataChannel{data: adjustedData, clickhouse: clickhouse}:
+		case jobs <- adjustedData:
 			// Successfully queued
 		default:
 			log.Printf("Warning: Channel buffer full, dropping tick for %s", data.Token)
 		}
 	}
-
-	// Connect to WebSocket
-	if err := wsClient.Connect(); err != nil {
-		log.Fatalf("Failed to connect to WebSocket: %v", err)
-	}
-	defer wsClient.Close()
-
-	// Send subscription request
-	if err := wsClient.SendJSON(subscribeReq); err != nil {
-		log.Fatalf("Failed to subscribe: %v", err)
-	}
-
-	// Start listening for messages
-	wsClient.Listen()
-
-	return nil
 }
 
 // Add health check handler
@@ -364,4 +744,34 @@ func metricsHandler(w http.ResponseWriter, r *http.Request, metrics *metrics.Met
 			"market_data_last_processed_timestamp " + strconv.FormatInt(lastProc.Unix(), 10) + "\n" +
 			"market_data_uptime_seconds " + strconv.FormatFloat(uptime.Seconds(), 'f', 1, 64) + "\n",
 	))
+	for reason, count := range metrics.InvalidFrameCounts() {
+		w.Write([]byte("market_data_invalid_frames_total{reason=\"" + reason + "\"} " + strconv.FormatUint(count, 10) + "\n"))
+	}
+	connected, pongAge, tickAge := metrics.GetConnectionState()
+	connectedValue := "0"
+	if connected {
+		connectedValue = "1"
+	}
+	w.Write([]byte(
+		"market_data_ws_connected " + connectedValue + "\n" +
+			"market_data_ws_last_pong_age_seconds " + strconv.FormatFloat(pongAge, 'f', 1, 64) + "\n" +
+			"market_data_ws_last_tick_age_seconds " + strconv.FormatFloat(tickAge, 'f', 1, 64) + "\n" +
+			"market_data_ws_resubscribed_tokens_total " + strconv.FormatUint(metrics.GetResubscribedTokens(), 10) + "\n",
+	))
+	batchSize, flushFailures, flushCount, flushSeconds := metrics.GetFlushStats()
+	w.Write([]byte(
+		"market_data_batch_size " + strconv.Itoa(batchSize) + "\n" +
+			"market_data_flush_failures_total " + strconv.FormatUint(flushFailures, 10) + "\n" +
+			"market_data_flush_duration_seconds_count " + strconv.FormatUint(flushCount, 10) + "\n" +
+			"market_data_flush_duration_seconds_sum " + strconv.FormatFloat(flushSeconds, 'f', 3, 64) + "\n",
+	))
+	depthFailures, depthCount, depthSeconds := metrics.GetDepthFlushStats()
+	w.Write([]byte(
+		"market_data_depth_flush_failures_total " + strconv.FormatUint(depthFailures, 10) + "\n" +
+			"market_data_depth_flush_duration_seconds_count " + strconv.FormatUint(depthCount, 10) + "\n" +
+			"market_data_depth_flush_duration_seconds_sum " + strconv.FormatFloat(depthSeconds, 'f', 3, 64) + "\n",
+	))
+	for code, count := range metrics.ServerErrorCounts() {
+		w.Write([]byte("market_data_server_errors_total{code=\"" + code + "\"} " + strconv.FormatUint(count, 10) + "\n"))
+	}
 }
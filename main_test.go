@@ -0,0 +1,252 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/config"
+	"angelone_clickhouse/metrics"
+	"angelone_clickhouse/models"
+	"angelone_clickhouse/parser"
+)
+
+var (
+	testMetricsOnce sync.Once
+	testMetrics     *metrics.Metrics
+)
+
+// sharedMetrics returns one Metrics for the whole test binary, as its
+// collectors register in the default Prometheus registry
+func sharedMetrics() *metrics.Metrics {
+	testMetricsOnce.Do(func() {
+		testMetrics = metrics.NewMetrics(&config.Config{})
+	})
+	return testMetrics
+}
+
+func TestInstrumentRows(t *testing.T) {
+	master := angel.NewScripMaster([]angel.Instrument{
+		{Token: "2885", Symbol: "RELIANCE-EQ", Name: "RELIANCE", Strike: "-1.000000", LotSize: "1", ExchSeg: "NSE", TickSize: "5.000000"},
+		{Token: "43607", Symbol: "NIFTY30JAN2523200PE", Name: "NIFTY", Expiry: "30JAN2025", Strike: "2320000.000000",
+			LotSize: "75", InstrumentType: "OPTIDX", ExchSeg: "NFO", TickSize: "5.000000"},
+		{Token: "1", Symbol: "BROKEN", ExchSeg: "MCX", LotSize: "-5", TickSize: "x"},
+		{Token: "9", Symbol: "UNKNOWN", ExchSeg: "XYZ"},
+	})
+	updatedAt := time.Date(2025, 1, 10, 8, 30, 0, 0, angel.IST)
+
+	rows := instrumentRows(master, updatedAt)
+
+	want := []models.Instrument{
+		{Exchange: models.NSE_CM, Token: "2885", Symbol: "RELIANCE-EQ", Name: "RELIANCE",
+			Expiry: time.Unix(0, 0).UTC(), Strike: 0, LotSize: 1, TickSize: 0.05, UpdatedAt: updatedAt},
+		{Exchange: models.NSE_FO, Token: "43607", Symbol: "NIFTY30JAN2523200PE", Name: "NIFTY", InstrumentType: "OPTIDX",
+			Expiry: time.Date(2025, 1, 30, 0, 0, 0, 0, time.UTC), Strike: 23200, LotSize: 75, TickSize: 0.05, UpdatedAt: updatedAt},
+		{Exchange: models.MCX_FO, Token: "1", Symbol: "BROKEN",
+			Expiry: time.Unix(0, 0).UTC(), LotSize: 0, TickSize: 0, UpdatedAt: updatedAt},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %d rows, want %d (unknown segments skipped): %+v", len(rows), len(want), rows)
+	}
+	for i := range want {
+		got := rows[i]
+		if got.Exchange != want[i].Exchange || got.Token != want[i].Token || got.Symbol != want[i].Symbol ||
+			got.Name != want[i].Name || got.InstrumentType != want[i].InstrumentType ||
+			!got.Expiry.Equal(want[i].Expiry) || got.Strike != want[i].Strike || got.LotSize != want[i].LotSize ||
+			got.TickSize != want[i].TickSize || !got.UpdatedAt.Equal(want[i].UpdatedAt) {
+			t.Errorf("row %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestDepthLevels(t *testing.T) {
+	depth := &parser.DepthData{
+		SubscriptionMode:   models.DepthMode,
+		ExchangeType:       models.NSE_FO,
+		Token:              "43607",
+		PacketReceivedTime: 1736912345123,
+	}
+	depth.Buy[0] = parser.DepthEntry{Quantity: 75, Price: 1234550, NumberOfOrders: 3}
+	depth.Buy[3] = parser.DepthEntry{Quantity: 150, Price: 1234000, NumberOfOrders: 5}
+	depth.Sell[0] = parser.DepthEntry{Quantity: 50, Price: 1234600, NumberOfOrders: 2}
+
+	timestamp := time.UnixMilli(1736912345123)
+	want := []models.DepthLevel{
+		{Timestamp: timestamp, Token: "43607", Exchange: models.NSE_FO, Side: models.DepthSideBuy,
+			Level: 1, Price: 12345.50, Quantity: 75, Orders: 3},
+		{Timestamp: timestamp, Token: "43607", Exchange: models.NSE_FO, Side: models.DepthSideBuy,
+			Level: 4, Price: 12340.00, Quantity: 150, Orders: 5},
+		{Timestamp: timestamp, Token: "43607", Exchange: models.NSE_FO, Side: models.DepthSideSell,
+			Level: 1, Price: 12346.00, Quantity: 50, Orders: 2},
+	}
+	if got := depthLevels(depth); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTickHandlerCountsInvalidFrames(t *testing.T) {
+	m := sharedMetrics()
+	jobs := make(chan MarketData, 10)
+	handle := tickHandler(jobs, nil, m)
+
+	ltp, err := parser.EncodeMarketData(&parser.MarketData{
+		SubscriptionMode: models.LtpMode,
+		ExchangeType:     models.NSE_CM,
+		Token:            "2885",
+		SequenceNumber:   7,
+		LastTradedPrice:  250050,
+	})
+	if err != nil {
+		t.Fatalf("EncodeMarketData: %v", err)
+	}
+	unknownExchange := append([]byte(nil), ltp...)
+	unknownExchange[1] = 6
+	unknownMode := append([]byte(nil), ltp...)
+	unknownMode[0] = 9
+
+	for _, tc := range []struct {
+		name   string
+		frame  []byte
+		reason string
+	}{
+		{"short LTP", ltp[:parser.LTPPacketSize-1], "short_frame"},
+		{"short depth", []byte{models.DepthMode, models.NSE_CM, 0}, "short_frame"},
+		{"unknown mode", unknownMode, "unknown_mode"},
+		{"unknown exchange", unknownExchange, "unknown_exchange"},
+	} {
+		before := m.InvalidFrameCounts()[tc.reason]
+		handle(tc.frame)
+		if got := m.InvalidFrameCounts()[tc.reason]; got != before+1 {
+			t.Errorf("%s: %s count went from %d to %d, want one more", tc.name, tc.reason, before, got)
+		}
+		if len(jobs) != 0 {
+			t.Fatalf("%s: invalid frame was queued", tc.name)
+		}
+	}
+
+	handle(ltp)
+	select {
+	case data := <-jobs:
+		if data.Token != "2885" || data.SequenceNumber != 7 || data.LastTradedPrice != 2500.50 {
+			t.Errorf("queued %+v, want token 2885, sequence 7, price 2500.50", data)
+		}
+	default:
+		t.Fatal("valid frame was not queued")
+	}
+}
+
+func TestApplyPriceDivisors(t *testing.T) {
+	t.Cleanup(func() {
+		parser.SetPriceDivisor(models.CDE_FO, parser.CurrencyPriceDivisor)
+		parser.SetPriceDivisor(models.MCX_FO, 0)
+	})
+
+	if err := applyPriceDivisors(map[string]float64{"CDE_FO": 10000, "NOPE": 10}); err == nil {
+		t.Fatal("expected an error for an unknown exchange")
+	}
+	if got := parser.PriceDivisor(models.CDE_FO); got != parser.CurrencyPriceDivisor {
+		t.Errorf("CDE_FO divisor changed to %v by a rejected override", got)
+	}
+
+	if err := applyPriceDivisors(map[string]float64{"CDE_FO": 10000, "MCX_FO": 1000}); err != nil {
+		t.Fatalf("applyPriceDivisors: %v", err)
+	}
+	if got := parser.ScalePrice(models.CDE_FO, 832150); got != 83.215 {
+		t.Errorf("CDE_FO price = %v, want 83.215", got)
+	}
+	if got := parser.ScalePrice(models.MCX_FO, 6150000); got != 6150 {
+		t.Errorf("MCX_FO price = %v, want 6150", got)
+	}
+	if got := parser.ScalePrice(models.NSE_CM, 250050); got != 2500.50 {
+		t.Errorf("NSE_CM price = %v, want the default divisor", got)
+	}
+}
+
+func TestGroupTokens(t *testing.T) {
+	got, err := groupTokens([]models.TokenConfig{
+		{Token: "2885", Exchange: "NSE_CM"},
+		{Token: "1594", Exchange: "NSE_CM", Mode: "quote"},
+		{Token: "99926000", Exchange: "NSE_CM", Mode: "SNAP_QUOTE"},
+		{Token: "43607", Exchange: "NSE_FO", Mode: "snap_quote"},
+		{Token: "43608", Exchange: "NSE_FO", Mode: "LTP"},
+		{Token: "234230", Exchange: "MCX_FO", Mode: "DEPTH"},
+		{Token: "", Exchange: "NSE_CM", Symbol: "UNRESOLVED"},
+		{Token: "1", Exchange: "XYZ"},
+	})
+	if err != nil {
+		t.Fatalf("groupTokens: %v", err)
+	}
+
+	want := map[int]map[int][]string{
+		models.QuoteMode: {models.NSE_CM: {"2885", "1594"}},
+		models.SnapQuote: {models.NSE_CM: {"99926000"}, models.NSE_FO: {"43607"}},
+		models.LtpMode:   {models.NSE_FO: {"43608"}},
+		models.DepthMode: {models.MCX_FO: {"234230"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupTokens = %v, want %v", got, want)
+	}
+}
+
+func TestGroupTokensRejectsUnknownMode(t *testing.T) {
+	for _, mode := range []string{"snapquote ", "FULL", "snapquote"} {
+		tokens := []models.TokenConfig{
+			{Token: "2885", Exchange: "NSE_CM"},
+			{Token: "43607", Exchange: "NSE_FO", Mode: mode},
+		}
+		if got, err := groupTokens(tokens); err == nil {
+			t.Errorf("mode %q: got %v, expected an error", mode, got)
+		}
+	}
+}
+
+func TestMarketTick(t *testing.T) {
+	receivedAt := time.Date(2025, 1, 10, 9, 15, 0, 250e6, angel.IST)
+	data := MarketData{
+		Token:             "43607",
+		ExchangeType:      models.NSE_FO,
+		LastTradedPrice:   123.45,
+		Volume:            4500000,
+		ReceivedAt:        receivedAt,
+		ExchangeTimestamp: 1736480699870,
+		SequenceNumber:    9001,
+		SubscriptionMode:  models.SnapQuote,
+
+		LastTradedTimestamp: 1736480699,
+		OpenInterest:        6543210,
+		BestFiveBuy:         [5]parser.BestFiveData{{Quantity: 75, Price: 12344, NumberOfOrders: 3}},
+		BestFiveSell:        [5]parser.BestFiveData{{BuySellFlag: 1, Quantity: 150, Price: 12350, NumberOfOrders: 4}},
+	}
+
+	tick := marketTick(data)
+
+	if !tick.Timestamp.Equal(receivedAt) {
+		t.Errorf("Timestamp = %v, want the receive time %v", tick.Timestamp, receivedAt)
+	}
+	if want := time.UnixMilli(1736480699870); !tick.ExchangeTimestamp.Equal(want) {
+		t.Errorf("ExchangeTimestamp = %v, want %v", tick.ExchangeTimestamp, want)
+	}
+	if tick.SequenceNumber != 9001 || tick.SubscriptionMode != models.SnapQuote {
+		t.Errorf("sequence %d, mode %d; want 9001 and %d", tick.SequenceNumber, tick.SubscriptionMode, models.SnapQuote)
+	}
+	if tick.Exchange != models.NSE_FO || tick.Symbol != "43607" || tick.LastPrice != 123.45 || tick.OpenInterest != 6543210 {
+		t.Errorf("tick %+v does not carry the instrument, price and open interest", tick)
+	}
+	if want := time.Unix(1736480699, 0); !tick.LastTradedTime.Equal(want) {
+		t.Errorf("LastTradedTime = %v, want %v", tick.LastTradedTime, want)
+	}
+	if tick.BidPrice != 123.44 || tick.AskPrice != 123.5 {
+		t.Errorf("bid %v, ask %v; want 123.44 and 123.5", tick.BidPrice, tick.AskPrice)
+	}
+	if !reflect.DeepEqual(tick.BestBuyQuantities, []int64{75}) || !reflect.DeepEqual(tick.BestSellOrders, []uint16{4}) {
+		t.Errorf("best five buy quantities %v, sell orders %v; want [75] and [4]", tick.BestBuyQuantities, tick.BestSellOrders)
+	}
+
+	// Without an exchange timestamp the receive time keeps the dedup key distinct
+	data.ExchangeTimestamp = 0
+	if tick := marketTick(data); !tick.ExchangeTimestamp.Equal(receivedAt) {
+		t.Errorf("ExchangeTimestamp without one from the exchange = %v, want %v", tick.ExchangeTimestamp, receivedAt)
+	}
+}
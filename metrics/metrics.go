@@ -16,13 +16,23 @@ const (
 )
 
 type Metrics struct {
-    config          *config.Config
-    processedTicks  prometheus.Counter
-    errorCount      prometheus.Counter
-    processingTime  prometheus.Histogram
-    batchSize       prometheus.Gauge
-    lastProcessed   time.Time
-    startTime       time.Time
+    config             *config.Config
+    processedTicks     prometheus.Counter
+    errorCount         prometheus.Counter
+    invalidFrames      *prometheus.CounterVec
+    serverErrors       *prometheus.CounterVec
+    wsConnected        prometheus.Gauge
+    resubscribed       prometheus.Counter
+    lastPongAge        prometheus.Gauge
+    lastTickAge        prometheus.Gauge
+    processingTime     prometheus.Histogram
+    batchSize          prometheus.Gauge
+    flushDuration      prometheus.Histogram
+    flushFailures      prometheus.Counter
+    depthFlushDuration prometheus.Histogram
+    depthFlushFailures prometheus.Counter
+    lastProcessed      time.Time
+    startTime          time.Time
 }
 
 func NewMetrics(cfg *config.Config) *Metrics {
@@ -45,6 +55,48 @@ func NewMetrics(cfg *config.Config) *Metrics {
         Help:      "Total number of errors encountered",
     })
     
+    m.invalidFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "invalid_frames_total",
+        Help:      "Total number of WebSocket frames rejected by the parser",
+    }, []string{"reason"})
+
+    m.serverErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "server_errors_total",
+        Help:      "Total number of error responses sent by the WebSocket server",
+    }, []string{"code"})
+
+    m.wsConnected = promauto.NewGauge(prometheus.GaugeOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "ws_connected",
+        Help:      "Whether the WebSocket connection is up (1) or down (0)",
+    })
+
+    m.resubscribed = promauto.NewCounter(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "ws_resubscribed_tokens_total",
+        Help:      "Total number of tokens re-subscribed after WebSocket reconnects",
+    })
+
+    m.lastPongAge = promauto.NewGauge(prometheus.GaugeOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "ws_last_pong_age_seconds",
+        Help:      "Seconds since the last pong was received from the WebSocket server",
+    })
+
+    m.lastTickAge = promauto.NewGauge(prometheus.GaugeOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "ws_last_tick_age_seconds",
+        Help:      "Seconds since the last binary tick was received",
+    })
+
     m.processingTime = promauto.NewHistogram(prometheus.HistogramOpts{
         Namespace: metricsNamespace,
         Subsystem: metricsSubsystem,
@@ -53,6 +105,43 @@ func NewMetrics(cfg *config.Config) *Metrics {
         Buckets:   prometheus.LinearBuckets(0.001, 0.001, 10),
     })
 
+    m.batchSize = promauto.NewGauge(prometheus.GaugeOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "batch_size",
+        Help:      "Number of ticks in the last batch flushed to ClickHouse",
+    })
+
+    m.flushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "flush_duration_seconds",
+        Help:      "Time taken to insert one batch of ticks",
+        Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+    })
+
+    m.flushFailures = promauto.NewCounter(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "flush_failures_total",
+        Help:      "Total number of tick batches that failed to insert",
+    })
+
+    m.depthFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "depth_flush_duration_seconds",
+        Help:      "Time taken to insert one batch of depth levels",
+        Buckets:   prometheus.ExponentialBuckets(0.005, 2, 10),
+    })
+
+    m.depthFlushFailures = promauto.NewCounter(prometheus.CounterOpts{
+        Namespace: metricsNamespace,
+        Subsystem: metricsSubsystem,
+        Name:      "depth_flush_failures_total",
+        Help:      "Total number of depth batches that failed to insert",
+    })
+
     return m
 }
 
@@ -65,6 +154,113 @@ func (m *Metrics) IncrementErrors() {
     m.errorCount.Inc()
 }
 
+func (m *Metrics) IncrementInvalidFrames(reason string) {
+    m.invalidFrames.WithLabelValues(reason).Inc()
+}
+
+// InvalidFrameCounts returns the number of rejected frames per reason
+func (m *Metrics) InvalidFrameCounts() map[string]uint64 {
+    return getCounterVecValues(m.invalidFrames, "reason")
+}
+
+func (m *Metrics) IncrementServerErrors(code string) {
+    m.serverErrors.WithLabelValues(code).Inc()
+}
+
+// ServerErrorCounts returns the number of server error responses per error code
+func (m *Metrics) ServerErrorCounts() map[string]uint64 {
+    return getCounterVecValues(m.serverErrors, "code")
+}
+
+// SetConnectionState records WebSocket liveness
+func (m *Metrics) SetConnectionState(connected bool, lastPongAge, lastTickAge time.Duration) {
+    if connected {
+        m.wsConnected.Set(1)
+    } else {
+        m.wsConnected.Set(0)
+    }
+    m.lastPongAge.Set(lastPongAge.Seconds())
+    m.lastTickAge.Set(lastTickAge.Seconds())
+}
+
+func (m *Metrics) AddResubscribedTokens(tokens int) {
+    m.resubscribed.Add(float64(tokens))
+}
+
+// GetResubscribedTokens returns the total number of tokens restored after reconnects
+func (m *Metrics) GetResubscribedTokens() uint64 {
+    if metric, err := getMetricValue(m.resubscribed); err == nil {
+        return uint64(metric.GetCounter().GetValue())
+    }
+    return 0
+}
+
+// GetConnectionState returns the values last recorded by SetConnectionState
+func (m *Metrics) GetConnectionState() (bool, float64, float64) {
+    var connected, pongAge, tickAge float64
+    if metric, err := getMetricValue(m.wsConnected); err == nil {
+        connected = metric.GetGauge().GetValue()
+    }
+    if metric, err := getMetricValue(m.lastPongAge); err == nil {
+        pongAge = metric.GetGauge().GetValue()
+    }
+    if metric, err := getMetricValue(m.lastTickAge); err == nil {
+        tickAge = metric.GetGauge().GetValue()
+    }
+    return connected == 1, pongAge, tickAge
+}
+
+// RecordFlush records one batch insert; it matches db.BatchWriter.OnFlush
+func (m *Metrics) RecordFlush(rows int, duration time.Duration, err error) {
+    m.batchSize.Set(float64(rows))
+    m.flushDuration.Observe(duration.Seconds())
+    if err != nil {
+        m.flushFailures.Inc()
+    }
+}
+
+// GetFlushStats returns the last batch size, the number of failed flushes and
+// the count and total seconds of all flushes
+func (m *Metrics) GetFlushStats() (int, uint64, uint64, float64) {
+    var size, failures float64
+    var count uint64
+    var seconds float64
+    if metric, err := getMetricValue(m.batchSize); err == nil {
+        size = metric.GetGauge().GetValue()
+    }
+    if metric, err := getMetricValue(m.flushFailures); err == nil {
+        failures = metric.GetCounter().GetValue()
+    }
+    if metric, err := getMetricValue(m.flushDuration); err == nil {
+        count = metric.GetHistogram().GetSampleCount()
+        seconds = metric.GetHistogram().GetSampleSum()
+    }
+    return int(size), uint64(failures), count, seconds
+}
+
+// RecordDepthFlush records one depth batch insert; it matches db.DepthWriter.OnFlush
+func (m *Metrics) RecordDepthFlush(rows int, duration time.Duration, err error) {
+    m.depthFlushDuration.Observe(duration.Seconds())
+    if err != nil {
+        m.depthFlushFailures.Inc()
+    }
+}
+
+// GetDepthFlushStats returns the number of failed depth flushes and the count
+// and total seconds of all depth flushes
+func (m *Metrics) GetDepthFlushStats() (uint64, uint64, float64) {
+    var failures, seconds float64
+    var count uint64
+    if metric, err := getMetricValue(m.depthFlushFailures); err == nil {
+        failures = metric.GetCounter().GetValue()
+    }
+    if metric, err := getMetricValue(m.depthFlushDuration); err == nil {
+        count = metric.GetHistogram().GetSampleCount()
+        seconds = metric.GetHistogram().GetSampleSum()
+    }
+    return uint64(failures), count, seconds
+}
+
 func (m *Metrics) RecordProcessingDuration(duration time.Duration) {
     m.processingTime.Observe(duration.Seconds())
 }
@@ -88,6 +284,31 @@ func (m *Metrics) GetStats() (uint64, uint64, time.Time, time.Duration) {
            time.Since(m.startTime)
 }
 
+// Helper function to get the value of each series of a counter vector keyed by one label
+func getCounterVecValues(vec *prometheus.CounterVec, labelName string) map[string]uint64 {
+    counts := make(map[string]uint64)
+
+    ch := make(chan prometheus.Metric, 16)
+    go func() {
+        vec.Collect(ch)
+        close(ch)
+    }()
+
+    for metric := range ch {
+        var value dto.Metric
+        if err := metric.Write(&value); err != nil {
+            continue
+        }
+        for _, label := range value.GetLabel() {
+            if label.GetName() == labelName {
+                counts[label.GetValue()] = uint64(value.GetCounter().GetValue())
+            }
+        }
+    }
+
+    return counts
+}
+
 // Helper function to get metric value
 func getMetricValue(metric prometheus.Collector) (*dto.Metric, error) {
     ch := make(chan prometheus.Metric, 1)
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"angelone_clickhouse/config"
+	"angelone_clickhouse/db"
+)
+
+// runMigrate applies, reverts or lists schema migrations
+//
+//	go run . migrate up
+//	go run . migrate down -steps 1
+//	go run . migrate status
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected up, down or status")
+	}
+
+	clickhouse, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	migrator := clickhouse.Migrator()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Printf("Schema is up to date")
+		}
+		return nil
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			log.Printf("Reverted migration %04d_%s", m.Version, m.Name)
+		}
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	}
+
+	return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+}
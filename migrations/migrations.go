@@ -0,0 +1,379 @@
+// Package migrations applies the versioned ClickHouse schema. Each version is
+// a pair of embedded files, NNNN_name.up.sql and NNNN_name.down.sql, holding
+// one or more statements terminated by semicolons. A statement preceded by a
+// "-- if: <query>" line runs only when the query returns a non-zero UInt8,
+// which lets a migration skip steps already done by a failed earlier run.
+// Applied versions are recorded in the schema_migrations table.
+//
+// Migrations that rebuild angelone_market_data (0006, 0008) do so online:
+//
+//  1. create the new table and copy every row into it, unless it already
+//     holds rows from an earlier run;
+//  2. copy the rows that arrived during that copy, starting at the latest
+//     timestamp copied;
+//  3. save that timestamp in a cutoff table, which survives the swap;
+//  4. swap the tables with EXCHANGE TABLES (atomic databases only) and keep
+//     the old one under a new name until it is dropped by hand;
+//  5. copy the old table's rows at or after the cutoff, which were written
+//     between step 2 and the swap, and drop the cutoff table.
+//
+// Steps 1 to 4 are guarded on the table still having its old layout and
+// step 5 on the cutoff table existing, so a run that failed at any step can
+// be retried. The down migrations copy the rows back and swap under the same
+// guards, without the catch-up steps.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const createMigrationsTableSQL = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version UInt32,
+    name String,
+    applied UInt8,
+    changed_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(changed_at)
+ORDER BY version
+`
+
+// Migration is one schema version
+type Migration struct {
+	Version uint32
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is a migration and whether it is applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Params are substituted into the SQL files as ${DATABASE}, ${USER} and ${PASSWORD}
+type Params struct {
+	Database string
+	User     string
+	Password string
+}
+
+// Migrator applies migrations over a ClickHouse connection
+type Migrator struct {
+	conn       driver.Conn
+	params     Params
+	migrations []Migration
+}
+
+// New loads the embedded migrations. It panics if the files are malformed,
+// which is a build defect rather than a runtime condition.
+func New(conn driver.Conn, params Params) *Migrator {
+	migrations, err := load(files)
+	if err != nil {
+		panic(err)
+	}
+	return &Migrator{conn: conn, params: params, migrations: migrations}
+}
+
+// Latest returns the schema version the code expects
+func Latest() uint32 {
+	migrations, err := load(files)
+	if err != nil {
+		panic(err)
+	}
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// load reads and orders the migration files, requiring consecutive versions
+// starting at 1, each with an up and a down file
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint32]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: name must end in .up.sql or .down.sql", file)
+		}
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: name must start with a version, e.g. 0001_name", file)
+		}
+		version, err := strconv.ParseUint(number, 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %s: invalid version %q", file, number)
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join("sql", file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[uint32(version)]
+		if m == nil {
+			m = &Migration{Version: uint32(version), Name: name}
+			byVersion[uint32(version)] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != uint32(i+1) {
+			return nil, fmt.Errorf("migration versions must be consecutive from 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Version returns the highest applied version, 0 for an empty database
+func (m *Migrator) Version(ctx context.Context) (uint32, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var version uint32
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Check returns an error unless the database is at the version the code expects
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if latest := m.latest(); version != latest {
+		return fmt.Errorf("database schema is at version %d but this build expects %d; run `migrate up`", version, latest)
+	}
+	return nil
+}
+
+// Status lists every migration and whether it is applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = Status{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns those applied.
+// ClickHouse DDL is not transactional, so migrations are written to be safe
+// to re-run: a migration that fails part way is retried from the start.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := m.exec(ctx, migration.up); err != nil {
+			return done, fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		if err := m.record(ctx, migration, true); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the latest steps applied migrations and returns those reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if migration.Version > version {
+			continue
+		}
+		if err := m.exec(ctx, migration.down); err != nil {
+			return done, fmt.Errorf("reverting migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		if err := m.record(ctx, migration, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func (m *Migrator) latest() uint32 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// applied returns the applied versions and when they were applied
+func (m *Migrator) applied(ctx context.Context) (map[uint32]time.Time, error) {
+	if err := m.conn.Exec(ctx, createMigrationsTableSQL); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %v", err)
+	}
+
+	rows, err := m.conn.Query(ctx, "SELECT version, applied, changed_at FROM schema_migrations FINAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[uint32]time.Time)
+	for rows.Next() {
+		var (
+			version   uint32
+			isApplied uint8
+			changedAt time.Time
+		)
+		if err := rows.Scan(&version, &isApplied, &changedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %v", err)
+		}
+		if isApplied == 1 {
+			applied[version] = changedAt
+		}
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) record(ctx context.Context, migration Migration, applied bool) error {
+	var flag uint8
+	if applied {
+		flag = 1
+	}
+	err := m.conn.Exec(ctx, "INSERT INTO schema_migrations (version, name, applied, changed_at) VALUES (?, ?, ?, ?)",
+		migration.Version, migration.Name, flag, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %v", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// exec runs each statement of a migration file whose guard, if any, holds
+func (m *Migrator) exec(ctx context.Context, sql string) error {
+	for _, stmt := range parse(m.expand(sql)) {
+		if stmt.guard != "" {
+			var holds uint8
+			if err := m.conn.QueryRow(ctx, stmt.guard).Scan(&holds); err != nil {
+				return fmt.Errorf("guard %q: %v", stmt.guard, err)
+			}
+			if holds == 0 {
+				continue
+			}
+		}
+		if err := m.conn.Exec(ctx, stmt.sql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) expand(sql string) string {
+	return strings.NewReplacer(
+		"${DATABASE}", "`"+strings.ReplaceAll(escapeString(m.params.Database), "`", "``")+"`",
+		"${USER}", escapeString(m.params.User),
+		"${PASSWORD}", escapeString(m.params.Password),
+	).Replace(sql)
+}
+
+// statement is one statement of a migration file and the query guarding it
+type statement struct {
+	sql   string
+	guard string
+}
+
+// Statements splits a migration file into statements, dropping comment lines.
+// A statement ends with a semicolon at the end of a line.
+func Statements(sql string) []string {
+	var statements []string
+	for _, stmt := range parse(sql) {
+		statements = append(statements, stmt.sql)
+	}
+	return statements
+}
+
+// parse splits a migration file like Statements, attaching each "-- if:"
+// guard to the statement that follows it
+func parse(sql string) []statement {
+	var statements []statement
+	var current strings.Builder
+	var guard string
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if query, ok := strings.CutPrefix(trimmed, "-- if:"); ok {
+			guard = strings.TrimSpace(query)
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, statement{strings.TrimSuffix(strings.TrimSpace(current.String()), ";"), guard})
+			current.Reset()
+			guard = ""
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, statement{rest, guard})
+	}
+	return statements
+}
+
+// escapeString escapes a value for a single-quoted SQL string literal
+func escapeString(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
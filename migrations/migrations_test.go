@@ -0,0 +1,214 @@
+package migrations
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeConn records executed statements and answers guard queries from guards
+type fakeConn struct {
+	driver.Conn
+	guards map[string]uint8
+	execs  []string
+}
+
+func (c *fakeConn) Exec(ctx context.Context, query string, args ...any) error {
+	c.execs = append(c.execs, query)
+	return nil
+}
+
+func (c *fakeConn) QueryRow(ctx context.Context, query string, args ...any) driver.Row {
+	return fakeRow{c.guards[query]}
+}
+
+type fakeRow struct {
+	value uint8
+}
+
+func (r fakeRow) Err() error { return nil }
+
+func (r fakeRow) Scan(dest ...any) error {
+	*dest[0].(*uint8) = r.value
+	return nil
+}
+
+func (r fakeRow) ScanStruct(dest any) error { return nil }
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	if Latest() != migrations[len(migrations)-1].Version {
+		t.Errorf("Latest() = %d, want %d", Latest(), migrations[len(migrations)-1].Version)
+	}
+
+	for _, m := range migrations {
+		for direction, sql := range map[string]string{"up": m.up, "down": m.down} {
+			if len(Statements(sql)) == 0 {
+				t.Errorf("migration %04d_%s %s has no statements", m.Version, m.Name, direction)
+			}
+		}
+	}
+}
+
+func TestLoadRejectsMalformedMigrations(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"sql/0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"gap": {
+			"sql/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"sql/0003_c.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/0003_c.down.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"sql/create.up.sql":   {Data: []byte("SELECT 1;")},
+			"sql/create.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	sql := `-- comment; not a statement
+CREATE TABLE t (
+    a String
+) ENGINE = Memory;
+
+ALTER TABLE t ADD COLUMN b String;
+SELECT 'no trailing semicolon'`
+
+	got := Statements(sql)
+	want := []string{
+		"CREATE TABLE t (\n    a String\n) ENGINE = Memory",
+		"ALTER TABLE t ADD COLUMN b String",
+		"SELECT 'no trailing semicolon'",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d statements %q, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseGuards(t *testing.T) {
+	sql := `-- if: SELECT 1
+CREATE TABLE t (a String) ENGINE = Memory;
+-- a plain comment
+INSERT INTO t VALUES ('x');
+-- if: SELECT count() = 0 FROM t
+DROP TABLE t;`
+
+	got := parse(sql)
+	want := []statement{
+		{"CREATE TABLE t (a String) ENGINE = Memory", "SELECT 1"},
+		{"INSERT INTO t VALUES ('x')", ""},
+		{"DROP TABLE t", "SELECT count() = 0 FROM t"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExecSkipsStatementsWhoseGuardFails(t *testing.T) {
+	conn := &fakeConn{guards: map[string]uint8{"SELECT 1": 1, "SELECT 0": 0}}
+	m := &Migrator{conn: conn}
+
+	err := m.exec(context.Background(), `-- if: SELECT 0
+CREATE TABLE skipped (a String) ENGINE = Memory;
+-- if: SELECT 1
+CREATE TABLE guarded (a String) ENGINE = Memory;
+CREATE TABLE unguarded (a String) ENGINE = Memory;`)
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	want := []string{
+		"CREATE TABLE guarded (a String) ENGINE = Memory",
+		"CREATE TABLE unguarded (a String) ENGINE = Memory",
+	}
+	if !reflect.DeepEqual(conn.execs, want) {
+		t.Errorf("executed %q, want %q", conn.execs, want)
+	}
+}
+
+// TestSwapMigrationsAreRetryable checks that every step up to and including
+// EXCHANGE TABLES is guarded, so a run that failed after the swap is not
+// repeated against the already swapped table
+func TestSwapMigrationsAreRetryable(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	swaps := map[uint32]bool{6: true, 8: true}
+	for _, m := range migrations {
+		if !swaps[m.Version] {
+			continue
+		}
+		for direction, sql := range map[string]string{"up": m.up, "down": m.down} {
+			swapped := false
+			for _, stmt := range parse(sql) {
+				if swapped {
+					break
+				}
+				swapped = strings.HasPrefix(stmt.sql, "EXCHANGE TABLES")
+				if stmt.guard == "" {
+					t.Errorf("%04d %s: unguarded step before the swap: %.60s", m.Version, direction, stmt.sql)
+				}
+			}
+			if !swapped {
+				t.Errorf("%04d %s: no EXCHANGE TABLES", m.Version, direction)
+			}
+		}
+	}
+}
+
+// TestDictionaryCredentialsAreNotRestored checks that from 0009 on neither
+// direction writes the ClickHouse password into dictionary metadata
+func TestDictionaryCredentialsAreNotRestored(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.Version < 9 {
+			continue
+		}
+		for direction, sql := range map[string]string{"up": m.up, "down": m.down} {
+			if strings.Contains(sql, "${PASSWORD}") {
+				t.Errorf("%04d %s embeds ${PASSWORD}", m.Version, direction)
+			}
+		}
+	}
+}
+
+func TestExpandEscapesParams(t *testing.T) {
+	m := &Migrator{params: Params{Database: "market", User: "ingest", Password: `p'a\ss`}}
+	got := m.expand("FROM ${DATABASE}.t USER '${USER}' PASSWORD '${PASSWORD}'")
+	want := "FROM `market`.t USER 'ingest' PASSWORD 'p\\'a\\\\ss'"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if strings.Contains(got, "${") {
+		t.Errorf("unexpanded parameter in %s", got)
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS angelone_market_data (
+    token String,
+    timestamp DateTime64(3),
+    last_traded_price Float64,
+    open_price Float64,
+    high_price Float64,
+    low_price Float64,
+    close_price Float64,
+    volume Float64
+) ENGINE = MergeTree()
+ORDER BY timestamp;
@@ -0,0 +1,13 @@
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS last_traded_time;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS open_interest;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS open_interest_change;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_buy_prices;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_buy_quantities;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_buy_orders;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_sell_prices;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_sell_quantities;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS best_sell_orders;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS upper_circuit_limit;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS lower_circuit_limit;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS week_52_high;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS week_52_low;
@@ -0,0 +1,13 @@
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS last_traded_time DateTime;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS open_interest Int64;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS open_interest_change Float64;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_buy_prices Array(Float64);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_buy_quantities Array(Int64);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_buy_orders Array(UInt16);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_sell_prices Array(Float64);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_sell_quantities Array(Int64);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS best_sell_orders Array(UInt16);
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS upper_circuit_limit Float64;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS lower_circuit_limit Float64;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS week_52_high Float64;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS week_52_low Float64;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS angelone_market_depth;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS angelone_market_depth (
+    timestamp DateTime64(3),
+    token String,
+    exchange UInt8,
+    side LowCardinality(String),
+    level UInt8,
+    price Float64,
+    quantity Int64,
+    orders UInt16
+) ENGINE = MergeTree()
+ORDER BY (token, timestamp, side, level);
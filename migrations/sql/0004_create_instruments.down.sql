@@ -0,0 +1,2 @@
+DROP DICTIONARY IF EXISTS instruments_dict;
+DROP TABLE IF EXISTS instruments;
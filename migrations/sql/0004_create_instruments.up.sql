@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS instruments (
+    exchange UInt8,
+    token String,
+    symbol String,
+    name LowCardinality(String),
+    instrument_type LowCardinality(String),
+    expiry Date,
+    strike Float64,
+    lot_size UInt32,
+    tick_size Float64,
+    updated_at DateTime
+) ENGINE = ReplacingMergeTree(updated_at)
+ORDER BY (exchange, token);
+
+-- Resolves tokens natively, e.g. dictGet('instruments_dict', 'symbol', (toUInt8(1), token)).
+-- The source reads with FINAL so only the latest version of each instrument is loaded.
+CREATE DICTIONARY IF NOT EXISTS instruments_dict (
+    exchange UInt8,
+    token String,
+    symbol String,
+    name String,
+    instrument_type String,
+    expiry Date,
+    strike Float64,
+    lot_size UInt32,
+    tick_size Float64
+)
+PRIMARY KEY exchange, token
+SOURCE(CLICKHOUSE(
+    QUERY 'SELECT exchange, token, symbol, name, instrument_type, expiry, strike, lot_size, tick_size FROM ${DATABASE}.instruments FINAL'
+    USER '${USER}' PASSWORD '${PASSWORD}'
+))
+LIFETIME(MIN 300 MAX 3600)
+LAYOUT(COMPLEX_KEY_HASHED());
@@ -0,0 +1,16 @@
+-- Candles are replaced on their key, so re-running a backfill over the same
+-- range keeps one row per candle. Read with FINAL to hide rows not yet merged.
+CREATE TABLE IF NOT EXISTS angelone_candles (
+    exchange UInt8,
+    token String,
+    interval LowCardinality(String),
+    timestamp DateTime,
+    open Float64,
+    high Float64,
+    low Float64,
+    close Float64,
+    volume Int64,
+    inserted_at DateTime64(3)
+) ENGINE = ReplacingMergeTree(inserted_at)
+PARTITION BY toYYYYMM(timestamp)
+ORDER BY (exchange, token, interval, timestamp);
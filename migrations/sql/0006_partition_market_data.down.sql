@@ -0,0 +1,48 @@
+-- Restores the unpartitioned layout, copying every row back without the
+-- exchange column, and drops the table kept from the up migration.
+-- Until the swap the table still has the exchange column.
+-- if: SELECT count() > 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+CREATE TABLE IF NOT EXISTS angelone_market_data_v1 (
+    token String,
+    timestamp DateTime64(3),
+    last_traded_price Float64,
+    open_price Float64,
+    high_price Float64,
+    low_price Float64,
+    close_price Float64,
+    volume Float64,
+    last_traded_time DateTime,
+    open_interest Int64,
+    open_interest_change Float64,
+    best_buy_prices Array(Float64),
+    best_buy_quantities Array(Int64),
+    best_buy_orders Array(UInt16),
+    best_sell_prices Array(Float64),
+    best_sell_quantities Array(Int64),
+    best_sell_orders Array(UInt16),
+    upper_circuit_limit Float64,
+    lower_circuit_limit Float64,
+    week_52_high Float64,
+    week_52_low Float64
+) ENGINE = MergeTree()
+ORDER BY timestamp;
+
+-- if: SELECT count() > 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+INSERT INTO angelone_market_data_v1
+SELECT
+    token, timestamp, last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE (SELECT count() FROM angelone_market_data_v1) = 0;
+
+-- if: SELECT count() > 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+EXCHANGE TABLES angelone_market_data AND angelone_market_data_v1;
+
+DROP TABLE IF EXISTS angelone_market_data_v1;
+
+DROP TABLE IF EXISTS angelone_market_data_legacy;
+
+DROP TABLE IF EXISTS angelone_market_data_cutoff;
@@ -0,0 +1,88 @@
+-- Rebuilds angelone_market_data partitioned by trading date (IST) and
+-- exchange and ordered by (exchange, token, timestamp), so per-token queries
+-- read only the matching granules and old days can be dropped by partition.
+-- The rebuild runs online as described in migrations.go; rows written before
+-- this migration have no exchange and get exchange 0. The old table is kept
+-- as angelone_market_data_legacy. A table without the exchange column has
+-- not been swapped yet.
+-- if: SELECT count() = 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+CREATE TABLE IF NOT EXISTS angelone_market_data_v2 (
+    exchange UInt8,
+    token LowCardinality(String),
+    timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD),
+    last_traded_price Float64 CODEC(Gorilla, ZSTD),
+    open_price Float64 CODEC(Gorilla, ZSTD),
+    high_price Float64 CODEC(Gorilla, ZSTD),
+    low_price Float64 CODEC(Gorilla, ZSTD),
+    close_price Float64 CODEC(Gorilla, ZSTD),
+    volume Float64 CODEC(Gorilla, ZSTD),
+    last_traded_time DateTime CODEC(Delta, ZSTD),
+    open_interest Int64 CODEC(Delta, ZSTD),
+    open_interest_change Float64 CODEC(Gorilla, ZSTD),
+    best_buy_prices Array(Float64) CODEC(ZSTD),
+    best_buy_quantities Array(Int64) CODEC(ZSTD),
+    best_buy_orders Array(UInt16) CODEC(ZSTD),
+    best_sell_prices Array(Float64) CODEC(ZSTD),
+    best_sell_quantities Array(Int64) CODEC(ZSTD),
+    best_sell_orders Array(UInt16) CODEC(ZSTD),
+    upper_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    lower_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    week_52_high Float64 CODEC(Gorilla, ZSTD),
+    week_52_low Float64 CODEC(Gorilla, ZSTD)
+) ENGINE = MergeTree()
+PARTITION BY (toDate(timestamp, 'Asia/Kolkata'), exchange)
+ORDER BY (exchange, token, timestamp);
+
+-- if: SELECT count() = 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+INSERT INTO angelone_market_data_v2
+SELECT
+    0 AS exchange, token, timestamp, last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE (SELECT count() FROM angelone_market_data_v2) = 0;
+
+-- A plain MergeTree keeps duplicates, so the catch-up skips the rows at the
+-- latest copied timestamp that are already there
+-- if: SELECT count() = 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+INSERT INTO angelone_market_data_v2
+SELECT
+    0 AS exchange, token, timestamp, last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_v2)
+    AND (token, timestamp, last_traded_price, volume) NOT IN (
+        SELECT token, timestamp, last_traded_price, volume FROM angelone_market_data_v2
+        WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_v2));
+
+-- if: SELECT count() = 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+CREATE TABLE IF NOT EXISTS angelone_market_data_cutoff ENGINE = TinyLog
+AS SELECT max(timestamp) AS timestamp FROM angelone_market_data_v2;
+
+-- if: SELECT count() = 0 FROM system.columns WHERE database = currentDatabase() AND table = 'angelone_market_data' AND name = 'exchange'
+EXCHANGE TABLES angelone_market_data AND angelone_market_data_v2;
+
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data_v2'
+RENAME TABLE angelone_market_data_v2 TO angelone_market_data_legacy;
+
+-- Deduplicated like the catch-up, against the new table
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data_cutoff'
+INSERT INTO angelone_market_data
+SELECT
+    0 AS exchange, token, timestamp, last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data_legacy
+WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_cutoff)
+    AND (token, timestamp, last_traded_price, volume) NOT IN (
+        SELECT token, timestamp, last_traded_price, volume FROM angelone_market_data
+        WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_cutoff));
+
+DROP TABLE IF EXISTS angelone_market_data_cutoff;
@@ -0,0 +1,8 @@
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS total_sell_quantity;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS total_buy_quantity;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS average_traded_price;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS last_traded_quantity;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS subscription_mode;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS sequence_number;
+ALTER TABLE angelone_market_data DROP COLUMN IF EXISTS exchange_timestamp;
+ALTER TABLE angelone_market_data COMMENT COLUMN timestamp '';
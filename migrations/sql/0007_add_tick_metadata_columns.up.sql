@@ -0,0 +1,11 @@
+-- timestamp is the time the frame was received; exchange_timestamp is the
+-- exchange's own time, so the difference measures feed latency and
+-- sequence_number orders ticks that share a timestamp
+ALTER TABLE angelone_market_data COMMENT COLUMN timestamp 'Time the frame was received';
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS exchange_timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD) AFTER timestamp;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS sequence_number Int64 CODEC(Delta, ZSTD) AFTER exchange_timestamp;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS subscription_mode UInt8 AFTER sequence_number;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS last_traded_quantity Int64 CODEC(T64, ZSTD) AFTER volume;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS average_traded_price Float64 CODEC(Gorilla, ZSTD) AFTER last_traded_quantity;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS total_buy_quantity Float64 CODEC(Gorilla, ZSTD) AFTER average_traded_price;
+ALTER TABLE angelone_market_data ADD COLUMN IF NOT EXISTS total_sell_quantity Float64 CODEC(Gorilla, ZSTD) AFTER total_buy_quantity;
@@ -0,0 +1,60 @@
+-- Restores the plain MergeTree layout of 0006 with the columns of 0007,
+-- copying every row back, and drops the table kept from the up migration.
+-- Rows whose exchange timestamp was filled from the receive time keep it.
+-- Until the swap the table is still a ReplacingMergeTree.
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+CREATE TABLE IF NOT EXISTS angelone_market_data_v2 (
+    exchange UInt8,
+    token LowCardinality(String),
+    timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD),
+    exchange_timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD),
+    sequence_number Int64 CODEC(Delta, ZSTD),
+    subscription_mode UInt8,
+    last_traded_price Float64 CODEC(Gorilla, ZSTD),
+    open_price Float64 CODEC(Gorilla, ZSTD),
+    high_price Float64 CODEC(Gorilla, ZSTD),
+    low_price Float64 CODEC(Gorilla, ZSTD),
+    close_price Float64 CODEC(Gorilla, ZSTD),
+    volume Float64 CODEC(Gorilla, ZSTD),
+    last_traded_quantity Int64 CODEC(T64, ZSTD),
+    average_traded_price Float64 CODEC(Gorilla, ZSTD),
+    total_buy_quantity Float64 CODEC(Gorilla, ZSTD),
+    total_sell_quantity Float64 CODEC(Gorilla, ZSTD),
+    last_traded_time DateTime CODEC(Delta, ZSTD),
+    open_interest Int64 CODEC(Delta, ZSTD),
+    open_interest_change Float64 CODEC(Gorilla, ZSTD),
+    best_buy_prices Array(Float64) CODEC(ZSTD),
+    best_buy_quantities Array(Int64) CODEC(ZSTD),
+    best_buy_orders Array(UInt16) CODEC(ZSTD),
+    best_sell_prices Array(Float64) CODEC(ZSTD),
+    best_sell_quantities Array(Int64) CODEC(ZSTD),
+    best_sell_orders Array(UInt16) CODEC(ZSTD),
+    upper_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    lower_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    week_52_high Float64 CODEC(Gorilla, ZSTD),
+    week_52_low Float64 CODEC(Gorilla, ZSTD)
+) ENGINE = MergeTree()
+PARTITION BY (toDate(timestamp, 'Asia/Kolkata'), exchange)
+ORDER BY (exchange, token, timestamp);
+
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+INSERT INTO angelone_market_data_v2
+SELECT
+    exchange, token, timestamp, exchange_timestamp, sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE (SELECT count() FROM angelone_market_data_v2) = 0;
+
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+EXCHANGE TABLES angelone_market_data AND angelone_market_data_v2;
+
+DROP TABLE IF EXISTS angelone_market_data_v2;
+
+DROP TABLE IF EXISTS angelone_market_data_pre_dedup;
+
+DROP TABLE IF EXISTS angelone_market_data_dedup_cutoff;
@@ -0,0 +1,127 @@
+-- Rebuilds angelone_market_data as a ReplacingMergeTree keyed by
+-- (exchange, token, exchange_timestamp, sequence_number), so a tick written
+-- twice after a reconnect or a retried insert collapses into one row on merge
+-- and reads with FINAL never see duplicates. The partition uses the exchange
+-- date so both copies of a tick always land in the same partition.
+--
+-- non_replicated_deduplication_window enables insert_deduplication_token on
+-- this non-replicated table: a retried batch with the same token is dropped
+-- at insert time instead of waiting for a merge.
+--
+-- The rebuild runs online as described in migrations.go and keeps the old
+-- table as angelone_market_data_pre_dedup. The columns are those of 0007, so
+-- the old layout is told apart by its engine.
+-- if: SELECT count() = 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+CREATE TABLE IF NOT EXISTS angelone_market_data_dedup (
+    exchange UInt8,
+    token LowCardinality(String),
+    timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD),
+    exchange_timestamp DateTime64(3) CODEC(DoubleDelta, ZSTD),
+    sequence_number Int64 CODEC(Delta, ZSTD),
+    subscription_mode UInt8,
+    last_traded_price Float64 CODEC(Gorilla, ZSTD),
+    open_price Float64 CODEC(Gorilla, ZSTD),
+    high_price Float64 CODEC(Gorilla, ZSTD),
+    low_price Float64 CODEC(Gorilla, ZSTD),
+    close_price Float64 CODEC(Gorilla, ZSTD),
+    volume Float64 CODEC(Gorilla, ZSTD),
+    last_traded_quantity Int64 CODEC(T64, ZSTD),
+    average_traded_price Float64 CODEC(Gorilla, ZSTD),
+    total_buy_quantity Float64 CODEC(Gorilla, ZSTD),
+    total_sell_quantity Float64 CODEC(Gorilla, ZSTD),
+    last_traded_time DateTime CODEC(Delta, ZSTD),
+    open_interest Int64 CODEC(Delta, ZSTD),
+    open_interest_change Float64 CODEC(Gorilla, ZSTD),
+    best_buy_prices Array(Float64) CODEC(ZSTD),
+    best_buy_quantities Array(Int64) CODEC(ZSTD),
+    best_buy_orders Array(UInt16) CODEC(ZSTD),
+    best_sell_prices Array(Float64) CODEC(ZSTD),
+    best_sell_quantities Array(Int64) CODEC(ZSTD),
+    best_sell_orders Array(UInt16) CODEC(ZSTD),
+    upper_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    lower_circuit_limit Float64 CODEC(Gorilla, ZSTD),
+    week_52_high Float64 CODEC(Gorilla, ZSTD),
+    week_52_low Float64 CODEC(Gorilla, ZSTD)
+) ENGINE = ReplacingMergeTree(timestamp)
+PARTITION BY (toDate(exchange_timestamp, 'Asia/Kolkata'), exchange)
+ORDER BY (exchange, token, exchange_timestamp, sequence_number)
+SETTINGS non_replicated_deduplication_window = 1000;
+
+-- Rows written before 0007 have no exchange timestamp; every copy uses their
+-- receive time instead so they keep distinct keys
+-- if: SELECT count() = 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+INSERT INTO angelone_market_data_dedup (
+    exchange, token, timestamp, exchange_timestamp, sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+)
+SELECT
+    exchange, token, timestamp, if(toUnixTimestamp64Milli(exchange_timestamp) = 0, timestamp, exchange_timestamp), sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE (SELECT count() FROM angelone_market_data_dedup) = 0;
+
+-- Rows at the latest copied timestamp are copied again rather than filtered:
+-- the copies share a key and collapse on merge
+-- if: SELECT count() = 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+INSERT INTO angelone_market_data_dedup (
+    exchange, token, timestamp, exchange_timestamp, sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+)
+SELECT
+    exchange, token, timestamp, if(toUnixTimestamp64Milli(exchange_timestamp) = 0, timestamp, exchange_timestamp), sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data
+WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_dedup);
+
+-- if: SELECT count() = 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+CREATE TABLE IF NOT EXISTS angelone_market_data_dedup_cutoff ENGINE = TinyLog
+AS SELECT max(timestamp) AS timestamp FROM angelone_market_data_dedup;
+
+-- if: SELECT count() = 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data' AND engine = 'ReplacingMergeTree'
+EXCHANGE TABLES angelone_market_data AND angelone_market_data_dedup;
+
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data_dedup'
+RENAME TABLE angelone_market_data_dedup TO angelone_market_data_pre_dedup;
+
+-- if: SELECT count() > 0 FROM system.tables WHERE database = currentDatabase() AND name = 'angelone_market_data_dedup_cutoff'
+INSERT INTO angelone_market_data (
+    exchange, token, timestamp, exchange_timestamp, sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+)
+SELECT
+    exchange, token, timestamp, if(toUnixTimestamp64Milli(exchange_timestamp) = 0, timestamp, exchange_timestamp), sequence_number, subscription_mode,
+    last_traded_price, open_price, high_price, low_price, close_price, volume,
+    last_traded_quantity, average_traded_price, total_buy_quantity, total_sell_quantity,
+    last_traded_time, open_interest, open_interest_change,
+    best_buy_prices, best_buy_quantities, best_buy_orders,
+    best_sell_prices, best_sell_quantities, best_sell_orders,
+    upper_circuit_limit, lower_circuit_limit, week_52_high, week_52_low
+FROM angelone_market_data_pre_dedup
+WHERE timestamp >= (SELECT max(timestamp) FROM angelone_market_data_dedup_cutoff);
+
+DROP TABLE IF EXISTS angelone_market_data_dedup_cutoff;
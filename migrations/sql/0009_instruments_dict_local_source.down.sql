@@ -0,0 +1,21 @@
+-- Reverting keeps instruments_dict credential-free rather than restoring the
+-- USER and PASSWORD source of 0004, which would write the password back into
+-- the dictionary metadata. The dictionary is recreated exactly as the up
+-- migration leaves it.
+CREATE OR REPLACE DICTIONARY instruments_dict (
+    exchange UInt8,
+    token String,
+    symbol String,
+    name String,
+    instrument_type String,
+    expiry Date,
+    strike Float64,
+    lot_size UInt32,
+    tick_size Float64
+)
+PRIMARY KEY exchange, token
+SOURCE(CLICKHOUSE(
+    QUERY 'SELECT exchange, token, symbol, name, instrument_type, expiry, strike, lot_size, tick_size FROM ${DATABASE}.instruments FINAL'
+))
+LIFETIME(MIN 300 MAX 3600)
+LAYOUT(COMPLEX_KEY_HASHED());
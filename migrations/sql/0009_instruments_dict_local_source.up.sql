@@ -0,0 +1,20 @@
+-- Recreates instruments_dict without credentials. The source is a local
+-- table, so the dictionary reads it in-process and no password is stored in
+-- the dictionary metadata, where rotating the password would break it.
+CREATE OR REPLACE DICTIONARY instruments_dict (
+    exchange UInt8,
+    token String,
+    symbol String,
+    name String,
+    instrument_type String,
+    expiry Date,
+    strike Float64,
+    lot_size UInt32,
+    tick_size Float64
+)
+PRIMARY KEY exchange, token
+SOURCE(CLICKHOUSE(
+    QUERY 'SELECT exchange, token, symbol, name, instrument_type, expiry, strike, lot_size, tick_size FROM ${DATABASE}.instruments FINAL'
+))
+LIFETIME(MIN 300 MAX 3600)
+LAYOUT(COMPLEX_KEY_HASHED());
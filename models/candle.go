@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Candle is one historical OHLCV bar, keyed by exchange, token, interval and timestamp
+type Candle struct {
+    Exchange   uint8     `ch:"exchange"`
+    Token      string    `ch:"token"`
+    Interval   string    `ch:"interval"`
+    Timestamp  time.Time `ch:"timestamp"`
+    Open       float64   `ch:"open"`
+    High       float64   `ch:"high"`
+    Low        float64   `ch:"low"`
+    Close      float64   `ch:"close"`
+    Volume     int64     `ch:"volume"`
+    InsertedAt time.Time `ch:"inserted_at"`
+}
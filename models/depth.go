@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+const (
+    DepthSideBuy  = "buy"
+    DepthSideSell = "sell"
+)
+
+// DepthLevel is one price level of an order book snapshot, stored one row per level
+type DepthLevel struct {
+    Timestamp time.Time `ch:"timestamp"`
+    Token     string    `ch:"token"`
+    Exchange  uint8     `ch:"exchange"`
+    Side      string    `ch:"side"`
+    Level     uint8     `ch:"level"`
+    Price     float64   `ch:"price"`
+    Quantity  int64     `ch:"quantity"`
+    Orders    uint16    `ch:"orders"`
+}
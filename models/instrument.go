@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Instrument is one row of the instruments dimension table, keyed by exchange and token
+type Instrument struct {
+    Exchange       uint8     `ch:"exchange"`
+    Token          string    `ch:"token"`
+    Symbol         string    `ch:"symbol"`
+    Name           string    `ch:"name"`
+    InstrumentType string    `ch:"instrument_type"`
+    Expiry         time.Time `ch:"expiry"`
+    Strike         float64   `ch:"strike"`
+    LotSize        uint32    `ch:"lot_size"`
+    TickSize       float64   `ch:"tick_size"`
+    UpdatedAt      time.Time `ch:"updated_at"`
+}
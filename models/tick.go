@@ -2,15 +2,46 @@ package models
 
 import "time"
 
+// MarketTick is one row of angelone_market_data. Fields without a ch tag
+// have no column and are ignored by batch inserts. Rows are unique by
+// exchange, token, exchange timestamp and sequence number.
 type MarketTick struct {
+    // Timestamp is when the frame was received, ExchangeTimestamp when the
+    // exchange generated it
     Timestamp   time.Time `ch:"timestamp"`
-    Symbol      string    `ch:"symbol"`
-    LastPrice   float64   `ch:"last_price"`
-    Volume      int64     `ch:"volume"`
-    BidPrice    float64   `ch:"bid_price"`
-    AskPrice    float64   `ch:"ask_price"`
+    Exchange    uint8     `ch:"exchange"`
+    Symbol      string    `ch:"token"`
+    LastPrice   float64   `ch:"last_traded_price"`
+    Volume      float64   `ch:"volume"`
+    BidPrice    float64
+    AskPrice    float64
     OpenPrice   float64   `ch:"open_price"`
     HighPrice   float64   `ch:"high_price"`
     LowPrice    float64   `ch:"low_price"`
     ClosePrice  float64   `ch:"close_price"`
+
+    ExchangeTimestamp time.Time `ch:"exchange_timestamp"`
+    SequenceNumber    int64     `ch:"sequence_number"`
+    SubscriptionMode  uint8     `ch:"subscription_mode"`
+
+    // Quote fields, zero for LTP subscriptions
+    LastTradedQuantity int64   `ch:"last_traded_quantity"`
+    AverageTradedPrice float64 `ch:"average_traded_price"`
+    TotalBuyQuantity   float64 `ch:"total_buy_quantity"`
+    TotalSellQuantity  float64 `ch:"total_sell_quantity"`
+
+    // SnapQuote fields, zero for LTP and Quote subscriptions
+    LastTradedTime     time.Time `ch:"last_traded_time"`
+    OpenInterest       int64     `ch:"open_interest"`
+    OpenInterestChange float64   `ch:"open_interest_change"`
+    BestBuyPrices      []float64 `ch:"best_buy_prices"`
+    BestBuyQuantities  []int64   `ch:"best_buy_quantities"`
+    BestBuyOrders      []uint16  `ch:"best_buy_orders"`
+    BestSellPrices     []float64 `ch:"best_sell_prices"`
+    BestSellQuantities []int64   `ch:"best_sell_quantities"`
+    BestSellOrders     []uint16  `ch:"best_sell_orders"`
+    UpperCircuitLimit  float64   `ch:"upper_circuit_limit"`
+    LowerCircuitLimit  float64   `ch:"lower_circuit_limit"`
+    FiftyTwoWeekHigh   float64   `ch:"week_52_high"`
+    FiftyTwoWeekLow    float64   `ch:"week_52_low"`
 }
@@ -4,6 +4,15 @@ type TokenConfig struct {
     Symbol   string `json:"symbol"`
     Token    string `json:"token"`
     Exchange string `json:"exchange"`
+    // Optional subscription mode (LTP, QUOTE, SNAP_QUOTE or DEPTH), Quote when empty
+    Mode     string `json:"mode,omitempty"`
+
+    // When Token is empty the instrument is resolved from the scrip master,
+    // by Symbol or by Name with the optional Expiry, Strike and OptionType
+    Name       string  `json:"name,omitempty"`
+    Expiry     string  `json:"expiry,omitempty"`
+    Strike     float64 `json:"strike,omitempty"`
+    OptionType string  `json:"option_type,omitempty"`
 }
 
 const (
@@ -36,3 +45,10 @@ var ExchangeMap = map[string]int{
     "NCX_FO":  NCX_FO,
     "CDE_FO":  CDE_FO,
 }
+
+var ModeMap = map[string]int{
+    "LTP":        LtpMode,
+    "QUOTE":      QuoteMode,
+    "SNAP_QUOTE": SnapQuote,
+    "DEPTH":      DepthMode,
+}
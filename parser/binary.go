@@ -1,8 +1,9 @@
 package parser
 
 import (
-    "bytes"
-    "encoding/binary"
+    "fmt"
+
+    "angelone_clickhouse/models"
 )
 
 type MarketData struct {
@@ -21,55 +22,145 @@ type MarketData struct {
     HighPriceOfTheDay    int64   `json:"high_price_of_the_day"`
     LowPriceOfTheDay     int64   `json:"low_price_of_the_day"`
     ClosedPrice          int64   `json:"closed_price"`
+
+    // SnapQuote (mode 3) fields
+    LastTradedTimestamp   int64             `json:"last_traded_timestamp"`
+    OpenInterest          int64             `json:"open_interest"`
+    OpenInterestChange    float64           `json:"open_interest_change_percentage"`
+    BestFiveBuy           [5]BestFiveData   `json:"best_5_buy_data"`
+    BestFiveSell          [5]BestFiveData   `json:"best_5_sell_data"`
+    UpperCircuitLimit     int64             `json:"upper_circuit_limit"`
+    LowerCircuitLimit     int64             `json:"lower_circuit_limit"`
+    FiftyTwoWeekHigh      int64             `json:"52_week_high_price"`
+    FiftyTwoWeekLow       int64             `json:"52_week_low_price"`
+}
+
+// BestFiveData is a single level of the best-five market depth sent in SnapQuote mode
+type BestFiveData struct {
+    BuySellFlag    uint16 `json:"flag"`
+    Quantity       int64  `json:"quantity"`
+    Price          int64  `json:"price"`
+    NumberOfOrders uint16 `json:"no_of_orders"`
 }
 
-// Helper methods return adjusted float64 values without modifying the original data
+// SnapQuote carries 10 best-five packets (5 buy + 5 sell) of 20 bytes each
+const bestFivePacketCount = 10
+
+// Helper methods return float64 values scaled by the exchange price divisor without modifying the original data
 func (md *MarketData) GetLastTradedPrice() float64 {
-    return float64(md.LastTradedPrice) / 100.0
+    return ScalePrice(md.ExchangeType, md.LastTradedPrice)
 }
 
 func (md *MarketData) GetOpenPrice() float64 {
-    return float64(md.OpenPriceOfTheDay) / 100.0
+    return ScalePrice(md.ExchangeType, md.OpenPriceOfTheDay)
 }
 
 func (md *MarketData) GetHighPrice() float64 {
-    return float64(md.HighPriceOfTheDay) / 100.0
+    return ScalePrice(md.ExchangeType, md.HighPriceOfTheDay)
 }
 
 func (md *MarketData) GetLowPrice() float64 {
-    return float64(md.LowPriceOfTheDay) / 100.0
+    return ScalePrice(md.ExchangeType, md.LowPriceOfTheDay)
 }
 
 func (md *MarketData) GetClosedPrice() float64 {
-    return float64(md.ClosedPrice) / 100.0
+    return ScalePrice(md.ExchangeType, md.ClosedPrice)
+}
+
+func (md *MarketData) GetUpperCircuitLimit() float64 {
+    return ScalePrice(md.ExchangeType, md.UpperCircuitLimit)
+}
+
+func (md *MarketData) GetLowerCircuitLimit() float64 {
+    return ScalePrice(md.ExchangeType, md.LowerCircuitLimit)
+}
+
+func (md *MarketData) GetFiftyTwoWeekHigh() float64 {
+    return ScalePrice(md.ExchangeType, md.FiftyTwoWeekHigh)
+}
+
+func (md *MarketData) GetFiftyTwoWeekLow() float64 {
+    return ScalePrice(md.ExchangeType, md.FiftyTwoWeekLow)
+}
+
+func (md *MarketData) GetAverageTradedPrice() float64 {
+    return ScalePrice(md.ExchangeType, md.AverageTradedPrice)
 }
 
+// GetBestFivePrice scales the price of one best-five level using the exchange of md
+func (md *MarketData) GetBestFivePrice(b *BestFiveData) float64 {
+    return ScalePrice(md.ExchangeType, b.Price)
+}
+
+// ParseBinaryData decodes an LTP, Quote or SnapQuote frame. Frames that are too
+// short for their declared mode, or declare an unknown mode or exchange, are
+// rejected with a *FrameError. Depth frames are decoded by ParseDepthData.
 func ParseBinaryData(data []byte) (*MarketData, error) {
+    mode, err := ValidateFrame(data)
+    if err != nil {
+        return nil, err
+    }
+    if mode == models.DepthMode {
+        return nil, &FrameError{Err: ErrUnknownMode, Mode: mode, Exchange: data[1], Length: len(data)}
+    }
+
     md := &MarketData{}
-    reader := bytes.NewReader(data)
+    reader := newFrameReader(data)
 
     // Parse the binary data into the struct fields
-    binary.Read(reader, binary.LittleEndian, &md.SubscriptionMode)
-    binary.Read(reader, binary.LittleEndian, &md.ExchangeType)
-    
-    tokenBytes := make([]byte, 25)
-    reader.Read(tokenBytes)
-    md.Token = string(bytes.TrimRight(tokenBytes, "\x00"))
-    
-    binary.Read(reader, binary.LittleEndian, &md.SequenceNumber)
-    binary.Read(reader, binary.LittleEndian, &md.ExchangeTimestamp)
-    binary.Read(reader, binary.LittleEndian, &md.LastTradedPrice)
+    reader.read(&md.SubscriptionMode)
+    reader.read(&md.ExchangeType)
+    md.Token = reader.readToken()
+
+    reader.read(&md.SequenceNumber)
+    reader.read(&md.ExchangeTimestamp)
+    reader.read(&md.LastTradedPrice)
     
     if md.SubscriptionMode >= 2 {
-        binary.Read(reader, binary.LittleEndian, &md.LastTradedQuantity)
-        binary.Read(reader, binary.LittleEndian, &md.AverageTradedPrice)
-        binary.Read(reader, binary.LittleEndian, &md.VolumeTrade)
-        binary.Read(reader, binary.LittleEndian, &md.TotalBuyQuantity)
-        binary.Read(reader, binary.LittleEndian, &md.TotalSellQuantity)
-        binary.Read(reader, binary.LittleEndian, &md.OpenPriceOfTheDay)
-        binary.Read(reader, binary.LittleEndian, &md.HighPriceOfTheDay)
-        binary.Read(reader, binary.LittleEndian, &md.LowPriceOfTheDay)
-        binary.Read(reader, binary.LittleEndian, &md.ClosedPrice)
+        reader.read(&md.LastTradedQuantity)
+        reader.read(&md.AverageTradedPrice)
+        reader.read(&md.VolumeTrade)
+        reader.read(&md.TotalBuyQuantity)
+        reader.read(&md.TotalSellQuantity)
+        reader.read(&md.OpenPriceOfTheDay)
+        reader.read(&md.HighPriceOfTheDay)
+        reader.read(&md.LowPriceOfTheDay)
+        reader.read(&md.ClosedPrice)
+    }
+
+    if md.SubscriptionMode >= 3 {
+        reader.read(&md.LastTradedTimestamp)
+        reader.read(&md.OpenInterest)
+        reader.read(&md.OpenInterestChange)
+
+        // Best five packets carry a flag: 0 for buy side, anything else for sell side
+        var buyCount, sellCount int
+        for i := 0; i < bestFivePacketCount; i++ {
+            var packet BestFiveData
+            reader.read(&packet.BuySellFlag)
+            reader.read(&packet.Quantity)
+            reader.read(&packet.Price)
+            reader.read(&packet.NumberOfOrders)
+
+            if packet.BuySellFlag == 0 {
+                if buyCount < len(md.BestFiveBuy) {
+                    md.BestFiveBuy[buyCount] = packet
+                    buyCount++
+                }
+            } else if sellCount < len(md.BestFiveSell) {
+                md.BestFiveSell[sellCount] = packet
+                sellCount++
+            }
+        }
+
+        reader.read(&md.UpperCircuitLimit)
+        reader.read(&md.LowerCircuitLimit)
+        reader.read(&md.FiftyTwoWeekHigh)
+        reader.read(&md.FiftyTwoWeekLow)
+    }
+
+    if reader.err != nil {
+        return nil, fmt.Errorf("error decoding mode %d frame: %w", mode, reader.err)
     }
 
     return md, nil
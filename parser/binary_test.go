@@ -0,0 +1,251 @@
+package parser
+
+import (
+    "encoding/binary"
+    "math"
+    "testing"
+)
+
+// snapQuoteFrame builds a SnapQuote frame for token 2885 on NSE_CM
+func snapQuoteFrame() []byte {
+    frame := make([]byte, SnapQuotePacketSize)
+    frame[0] = 3
+    frame[1] = 1
+    copy(frame[offsetToken:], "2885")
+
+    put := func(off int, v int64) { binary.LittleEndian.PutUint64(frame[off:], uint64(v)) }
+    put(offsetSequenceNumber, 42)
+    put(offsetExchangeTimestamp, 1736912345000)
+    put(offsetLastTradedPrice, 128550)
+    put(offsetLastTradedQuantity, 10)
+    put(offsetAverageTradedPrice, 128012)
+    put(offsetVolumeTrade, 1500000)
+    binary.LittleEndian.PutUint64(frame[offsetTotalBuyQuantity:], math.Float64bits(25000))
+    binary.LittleEndian.PutUint64(frame[offsetTotalSellQuantity:], math.Float64bits(31000))
+    put(offsetOpenPrice, 127500)
+    put(offsetHighPrice, 129000)
+    put(offsetLowPrice, 127000)
+    put(offsetClosedPrice, 127800)
+    put(offsetLastTradedTimestamp, 1736912344)
+    put(offsetOpenInterest, 0)
+    binary.LittleEndian.PutUint64(frame[offsetOpenInterestChange:], math.Float64bits(1.5))
+
+    for i := 0; i < bestFivePacketCount; i++ {
+        off := offsetBestFive + i*bestFivePacketSize
+        var flag uint16
+        if i >= 5 {
+            flag = 1
+        }
+        binary.LittleEndian.PutUint16(frame[off:], flag)
+        put(off+2, int64(100*(i+1)))
+        put(off+10, int64(128500+10*i))
+        binary.LittleEndian.PutUint16(frame[off+18:], uint16(i+1))
+    }
+
+    put(offsetUpperCircuitLimit, 141400)
+    put(offsetLowerCircuitLimit, 115700)
+    put(offsetFiftyTwoWeekHigh, 160800)
+    put(offsetFiftyTwoWeekLow, 120100)
+    return frame
+}
+
+// nfoSnapQuote is a SnapQuote frame for NIFTY option 43607 on NSE_FO laid out
+// by hand from the documented byte offsets rather than the parser's constants.
+// Best-five packets alternate between the buy and sell side.
+func nfoSnapQuote() []byte {
+    frame := make([]byte, 379)
+    frame[0] = 3
+    frame[1] = 2
+    copy(frame[2:27], "43607")
+
+    le64 := func(off int, v uint64) { binary.LittleEndian.PutUint64(frame[off:], v) }
+    le64(27, 9001)
+    le64(35, 1736912345000)
+    le64(43, 12345)
+    le64(51, 75)
+    le64(59, 12290)
+    le64(67, 4500000)
+    le64(75, math.Float64bits(180000))
+    le64(83, math.Float64bits(165000))
+    le64(91, 12000)
+    le64(99, 12600)
+    le64(107, 11850)
+    le64(115, 11900)
+    le64(123, 1736912344)
+    le64(131, 6543210)
+    le64(139, math.Float64bits(-2.75))
+
+    // flag, quantity, price, orders; the first packet spelled out byte by byte
+    copy(frame[147:167], []byte{
+        0x00, 0x00,
+        0x4b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0x38, 0x30, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+        0x03, 0x00,
+    })
+    for i := 1; i < 10; i++ {
+        off := 147 + i*20
+        binary.LittleEndian.PutUint16(frame[off:], uint16(i%2))
+        le64(off+2, uint64(75*(i+1)))
+        if i%2 == 0 {
+            le64(off+10, uint64(12344-5*(i/2)))
+        } else {
+            le64(off+10, uint64(12350+5*(i/2)))
+        }
+        binary.LittleEndian.PutUint16(frame[off+18:], uint16(i+3))
+    }
+
+    le64(347, 14800)
+    le64(355, 9900)
+    le64(363, 25000)
+    le64(371, 8500)
+    return frame
+}
+
+func TestParseSnapQuote(t *testing.T) {
+    want := MarketData{
+        SubscriptionMode:    3,
+        ExchangeType:        2,
+        Token:               "43607",
+        SequenceNumber:      9001,
+        ExchangeTimestamp:   1736912345000,
+        LastTradedPrice:     12345,
+        LastTradedQuantity:  75,
+        AverageTradedPrice:  12290,
+        VolumeTrade:         4500000,
+        TotalBuyQuantity:    180000,
+        TotalSellQuantity:   165000,
+        OpenPriceOfTheDay:   12000,
+        HighPriceOfTheDay:   12600,
+        LowPriceOfTheDay:    11850,
+        ClosedPrice:         11900,
+        LastTradedTimestamp: 1736912344,
+        OpenInterest:        6543210,
+        OpenInterestChange:  -2.75,
+        BestFiveBuy: [5]BestFiveData{
+            {0, 75, 12344, 3},
+            {0, 225, 12339, 5},
+            {0, 375, 12334, 7},
+            {0, 525, 12329, 9},
+            {0, 675, 12324, 11},
+        },
+        BestFiveSell: [5]BestFiveData{
+            {1, 150, 12350, 4},
+            {1, 300, 12355, 6},
+            {1, 450, 12360, 8},
+            {1, 600, 12365, 10},
+            {1, 750, 12370, 12},
+        },
+        UpperCircuitLimit: 14800,
+        LowerCircuitLimit: 9900,
+        FiftyTwoWeekHigh:  25000,
+        FiftyTwoWeekLow:   8500,
+    }
+
+    parsed, err := ParseBinaryData(nfoSnapQuote())
+    if err != nil {
+        t.Fatalf("ParseBinaryData: %v", err)
+    }
+    var decoded MarketData
+    if err := DecodeMarketData(nfoSnapQuote(), &decoded); err != nil {
+        t.Fatalf("DecodeMarketData: %v", err)
+    }
+
+    for name, got := range map[string]MarketData{"ParseBinaryData": *parsed, "DecodeMarketData": decoded} {
+        if got != want {
+            t.Errorf("%s:\ngot  %+v\nwant %+v", name, got, want)
+        }
+    }
+
+    // Scaled values as stored, NSE_FO prices being in paise
+    for _, tt := range []struct {
+        name string
+        got  float64
+        want float64
+    }{
+        {"last traded", parsed.GetLastTradedPrice(), 123.45},
+        {"upper circuit", parsed.GetUpperCircuitLimit(), 148},
+        {"lower circuit", parsed.GetLowerCircuitLimit(), 99},
+        {"52-week high", parsed.GetFiftyTwoWeekHigh(), 250},
+        {"52-week low", parsed.GetFiftyTwoWeekLow(), 85},
+        {"best bid", parsed.GetBestFivePrice(&parsed.BestFiveBuy[0]), 123.44},
+        {"best offer", parsed.GetBestFivePrice(&parsed.BestFiveSell[0]), 123.5},
+    } {
+        if tt.got != tt.want {
+            t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+        }
+    }
+}
+
+func TestDecodeMarketDataMatchesParseBinaryData(t *testing.T) {
+    frame := snapQuoteFrame()
+    for _, size := range []int{LTPPacketSize, QuotePacketSize, SnapQuotePacketSize} {
+        data := append([]byte(nil), frame[:size]...)
+        switch size {
+        case LTPPacketSize:
+            data[0] = 1
+        case QuotePacketSize:
+            data[0] = 2
+        }
+
+        want, err := ParseBinaryData(data)
+        if err != nil {
+            t.Fatalf("ParseBinaryData(mode %d): %v", data[0], err)
+        }
+
+        var got MarketData
+        if err := DecodeMarketData(data, &got); err != nil {
+            t.Fatalf("DecodeMarketData(mode %d): %v", data[0], err)
+        }
+        if got != *want {
+            t.Errorf("mode %d: decoded %+v, want %+v", data[0], got, *want)
+        }
+    }
+}
+
+func TestDecodeMarketDataDoesNotAllocate(t *testing.T) {
+    frame := snapQuoteFrame()
+    var md MarketData
+    allocs := testing.AllocsPerRun(100, func() {
+        if err := DecodeMarketData(frame, &md); err != nil {
+            t.Fatal(err)
+        }
+    })
+    if allocs != 0 {
+        t.Errorf("DecodeMarketData allocated %.1f times per frame", allocs)
+    }
+}
+
+func BenchmarkParseBinaryData(b *testing.B) {
+    frame := snapQuoteFrame()
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if _, err := ParseBinaryData(frame); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkDecodeMarketData(b *testing.B) {
+    frame := snapQuoteFrame()
+    var md MarketData
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if err := DecodeMarketData(frame, &md); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func BenchmarkDecodeMarketDataPooled(b *testing.B) {
+    frame := snapQuoteFrame()
+    b.ReportAllocs()
+    b.RunParallel(func(pb *testing.PB) {
+        for pb.Next() {
+            md := AcquireMarketData()
+            if err := DecodeMarketData(frame, md); err != nil {
+                b.Fatal(err)
+            }
+            ReleaseMarketData(md)
+        }
+    })
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+    "bytes"
+    "encoding/binary"
+    "math"
+    "sync"
+
+    "angelone_clickhouse/models"
+)
+
+// Field offsets within a tick frame
+const (
+    offsetToken               = 2
+    offsetSequenceNumber      = 27
+    offsetExchangeTimestamp   = 35
+    offsetLastTradedPrice     = 43
+    offsetLastTradedQuantity  = 51
+    offsetAverageTradedPrice  = 59
+    offsetVolumeTrade         = 67
+    offsetTotalBuyQuantity    = 75
+    offsetTotalSellQuantity   = 83
+    offsetOpenPrice           = 91
+    offsetHighPrice           = 99
+    offsetLowPrice            = 107
+    offsetClosedPrice         = 115
+    offsetLastTradedTimestamp = 123
+    offsetOpenInterest        = 131
+    offsetOpenInterestChange  = 139
+    offsetBestFive            = 147
+    offsetUpperCircuitLimit   = 347
+    offsetLowerCircuitLimit   = 355
+    offsetFiftyTwoWeekHigh    = 363
+    offsetFiftyTwoWeekLow     = 371
+
+    bestFivePacketSize = 20
+)
+
+var marketDataPool = sync.Pool{
+    New: func() interface{} { return new(MarketData) },
+}
+
+// AcquireMarketData returns a MarketData from the pool for use with DecodeMarketData
+func AcquireMarketData() *MarketData {
+    return marketDataPool.Get().(*MarketData)
+}
+
+// ReleaseMarketData returns md to the pool. md must not be used afterwards.
+func ReleaseMarketData(md *MarketData) {
+    marketDataPool.Put(md)
+}
+
+// DecodeMarketData decodes an LTP, Quote or SnapQuote frame into md by reading
+// fields at their fixed offsets. It performs the same validation as
+// ParseBinaryData but does not allocate once a token has been seen.
+func DecodeMarketData(data []byte, md *MarketData) error {
+    mode, err := ValidateFrame(data)
+    if err != nil {
+        return err
+    }
+    if mode == models.DepthMode {
+        return &FrameError{Err: ErrUnknownMode, Mode: mode, Exchange: data[1], Length: len(data)}
+    }
+
+    *md = MarketData{
+        SubscriptionMode:  mode,
+        ExchangeType:      data[1],
+        Token:             internToken(data[offsetToken : offsetToken+tokenSize]),
+        SequenceNumber:    readInt64(data, offsetSequenceNumber),
+        ExchangeTimestamp: readInt64(data, offsetExchangeTimestamp),
+        LastTradedPrice:   readInt64(data, offsetLastTradedPrice),
+    }
+
+    if mode >= 2 {
+        md.LastTradedQuantity = readInt64(data, offsetLastTradedQuantity)
+        md.AverageTradedPrice = readInt64(data, offsetAverageTradedPrice)
+        md.VolumeTrade = readInt64(data, offsetVolumeTrade)
+        md.TotalBuyQuantity = readFloat64(data, offsetTotalBuyQuantity)
+        md.TotalSellQuantity = readFloat64(data, offsetTotalSellQuantity)
+        md.OpenPriceOfTheDay = readInt64(data, offsetOpenPrice)
+        md.HighPriceOfTheDay = readInt64(data, offsetHighPrice)
+        md.LowPriceOfTheDay = readInt64(data, offsetLowPrice)
+        md.ClosedPrice = readInt64(data, offsetClosedPrice)
+    }
+
+    if mode >= 3 {
+        md.LastTradedTimestamp = readInt64(data, offsetLastTradedTimestamp)
+        md.OpenInterest = readInt64(data, offsetOpenInterest)
+        md.OpenInterestChange = readFloat64(data, offsetOpenInterestChange)
+
+        var buyCount, sellCount int
+        for i := 0; i < bestFivePacketCount; i++ {
+            off := offsetBestFive + i*bestFivePacketSize
+            packet := BestFiveData{
+                BuySellFlag:    binary.LittleEndian.Uint16(data[off:]),
+                Quantity:       readInt64(data, off+2),
+                Price:          readInt64(data, off+10),
+                NumberOfOrders: binary.LittleEndian.Uint16(data[off+18:]),
+            }
+
+            if packet.BuySellFlag == 0 {
+                if buyCount < len(md.BestFiveBuy) {
+                    md.BestFiveBuy[buyCount] = packet
+                    buyCount++
+                }
+            } else if sellCount < len(md.BestFiveSell) {
+                md.BestFiveSell[sellCount] = packet
+                sellCount++
+            }
+        }
+
+        md.UpperCircuitLimit = readInt64(data, offsetUpperCircuitLimit)
+        md.LowerCircuitLimit = readInt64(data, offsetLowerCircuitLimit)
+        md.FiftyTwoWeekHigh = readInt64(data, offsetFiftyTwoWeekHigh)
+        md.FiftyTwoWeekLow = readInt64(data, offsetFiftyTwoWeekLow)
+    }
+
+    return nil
+}
+
+func readInt64(data []byte, off int) int64 {
+    return int64(binary.LittleEndian.Uint64(data[off:]))
+}
+
+func readFloat64(data []byte, off int) float64 {
+    return math.Float64frombits(binary.LittleEndian.Uint64(data[off:]))
+}
+
+// Token strings are interned so repeated ticks for the same instrument reuse
+// one string instead of allocating a new one per frame.
+var (
+    tokenMu    sync.RWMutex
+    tokenCache = make(map[string]string)
+)
+
+func internToken(raw []byte) string {
+    raw = bytes.TrimRight(raw, "\x00")
+
+    tokenMu.RLock()
+    token, ok := tokenCache[string(raw)]
+    tokenMu.RUnlock()
+    if ok {
+        return token
+    }
+
+    tokenMu.Lock()
+    defer tokenMu.Unlock()
+    if token, ok := tokenCache[string(raw)]; ok {
+        return token
+    }
+    token = string(raw)
+    tokenCache[token] = token
+    return token
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+    "fmt"
+
+    "angelone_clickhouse/models"
+)
+
+// DepthLevels is the number of price levels per side in a depth-20 packet
+const DepthLevels = 20
+
+// DepthData is a depth-20 (mode 4) order book snapshot
+type DepthData struct {
+    SubscriptionMode   uint8                   `json:"subscription_mode"`
+    ExchangeType       uint8                   `json:"exchange_type"`
+    Token              string                  `json:"token"`
+    PacketReceivedTime int64                   `json:"packet_received_time"`
+    Buy                [DepthLevels]DepthEntry `json:"buy"`
+    Sell               [DepthLevels]DepthEntry `json:"sell"`
+}
+
+// DepthEntry is a single price level of a depth-20 packet
+type DepthEntry struct {
+    Quantity       int32 `json:"quantity"`
+    Price          int32 `json:"price"`
+    NumberOfOrders int16 `json:"num_of_orders"`
+}
+
+// GetPrice scales the price of one depth level using the exchange of d
+func (d *DepthData) GetPrice(e *DepthEntry) float64 {
+    return ScalePrice(d.ExchangeType, int64(e.Price))
+}
+
+// ParseDepthData decodes a depth-20 packet. The header matches the tick packets up to the
+// sequence number, followed by the receive timestamp, 20 buy levels and 20 sell levels.
+func ParseDepthData(data []byte) (*DepthData, error) {
+    mode, err := ValidateFrame(data)
+    if err != nil {
+        return nil, err
+    }
+    if mode != models.DepthMode {
+        return nil, &FrameError{Err: ErrUnknownMode, Mode: mode, Exchange: data[1], Length: len(data)}
+    }
+
+    d := &DepthData{}
+    reader := newFrameReader(data)
+
+    reader.read(&d.SubscriptionMode)
+    reader.read(&d.ExchangeType)
+    d.Token = reader.readToken()
+
+    // Sequence number is not populated for depth packets
+    var sequenceNumber int64
+    reader.read(&sequenceNumber)
+    reader.read(&d.PacketReceivedTime)
+
+    for _, side := range []*[DepthLevels]DepthEntry{&d.Buy, &d.Sell} {
+        for i := range side {
+            reader.read(&side[i].Quantity)
+            reader.read(&side[i].Price)
+            reader.read(&side[i].NumberOfOrders)
+        }
+    }
+
+    if reader.err != nil {
+        return nil, fmt.Errorf("error decoding depth frame: %w", reader.err)
+    }
+
+    return d, nil
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+    "encoding/binary"
+    "testing"
+
+    "angelone_clickhouse/models"
+)
+
+// depthFrame builds a depth-20 frame byte by byte, independently of the encoder
+func depthFrame() []byte {
+    frame := make([]byte, DepthPacketSize)
+    frame[0] = models.DepthMode
+    frame[1] = models.NSE_FO
+    copy(frame[2:27], "43607")
+    binary.LittleEndian.PutUint64(frame[27:35], 0)             // sequence number, unused
+    binary.LittleEndian.PutUint64(frame[35:43], 1736912345123) // packet received time
+
+    level := func(offset, quantity, price, orders int) {
+        binary.LittleEndian.PutUint32(frame[offset:], uint32(quantity))
+        binary.LittleEndian.PutUint32(frame[offset+4:], uint32(price))
+        binary.LittleEndian.PutUint16(frame[offset+8:], uint16(orders))
+    }
+    const buy, sell, entrySize = 43, 43 + DepthLevels*10, 10
+    level(buy, 75, 1234550, 3)
+    level(buy+entrySize, 150, 1234500, 5)
+    level(buy+19*entrySize, 900, 1230000, 12)
+    level(sell, 50, 1234600, 2)
+    return frame
+}
+
+func TestParseDepthData(t *testing.T) {
+    depth, err := ParseDepthData(depthFrame())
+    if err != nil {
+        t.Fatalf("ParseDepthData: %v", err)
+    }
+
+    if depth.SubscriptionMode != models.DepthMode || depth.ExchangeType != models.NSE_FO ||
+        depth.Token != "43607" || depth.PacketReceivedTime != 1736912345123 {
+        t.Errorf("header = mode %d, exchange %d, token %q, time %d",
+            depth.SubscriptionMode, depth.ExchangeType, depth.Token, depth.PacketReceivedTime)
+    }
+
+    tests := []struct {
+        name  string
+        entry DepthEntry
+        want  DepthEntry
+        price float64
+    }{
+        {"buy level 1", depth.Buy[0], DepthEntry{Quantity: 75, Price: 1234550, NumberOfOrders: 3}, 12345.50},
+        {"buy level 2", depth.Buy[1], DepthEntry{Quantity: 150, Price: 1234500, NumberOfOrders: 5}, 12345.00},
+        {"buy level 20", depth.Buy[19], DepthEntry{Quantity: 900, Price: 1230000, NumberOfOrders: 12}, 12300.00},
+        {"sell level 1", depth.Sell[0], DepthEntry{Quantity: 50, Price: 1234600, NumberOfOrders: 2}, 12346.00},
+        {"empty sell level 2", depth.Sell[1], DepthEntry{}, 0},
+    }
+    for _, tt := range tests {
+        if tt.entry != tt.want {
+            t.Errorf("%s = %+v, want %+v", tt.name, tt.entry, tt.want)
+        }
+        if got := depth.GetPrice(&tt.entry); got != tt.price {
+            t.Errorf("%s price = %v, want %v", tt.name, got, tt.price)
+        }
+    }
+}
@@ -0,0 +1,160 @@
+package parser
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math"
+
+    "angelone_clickhouse/models"
+)
+
+// Flags written for best-five levels. The decoder treats any non-zero flag as
+// the sell side; the encoder always writes these canonical values.
+const (
+    BestFiveBuyFlag  uint16 = 0
+    BestFiveSellFlag uint16 = 1
+)
+
+// Depth-20 layout: receive timestamp followed by 20 buy and 20 sell levels
+const (
+    offsetDepthReceivedTime = 35
+    offsetDepthBuy          = 43
+    offsetDepthSell         = offsetDepthBuy + DepthLevels*depthEntrySize
+    depthEntrySize          = 10
+)
+
+var ErrTokenTooLong = errors.New("token longer than 25 bytes")
+
+// EncodeMarketData serializes md into an LTP, Quote or SnapQuote frame
+// according to md.SubscriptionMode. See AppendMarketData.
+func EncodeMarketData(md *MarketData) ([]byte, error) {
+    return AppendMarketData(nil, md)
+}
+
+// AppendMarketData appends the wire encoding of md to dst. Only the fields
+// carried by md.SubscriptionMode are written. Decoding the result yields md
+// back, with best-five flags normalised to BestFiveBuyFlag and
+// BestFiveSellFlag, and decoded frames that use those flags re-encode byte
+// for byte.
+func AppendMarketData(dst []byte, md *MarketData) ([]byte, error) {
+    if md.SubscriptionMode == models.DepthMode {
+        return dst, fmt.Errorf("%w: use AppendDepthData for depth frames", ErrUnknownMode)
+    }
+    size, ok := PacketSize(md.SubscriptionMode)
+    if !ok {
+        return dst, fmt.Errorf("%w: %d", ErrUnknownMode, md.SubscriptionMode)
+    }
+
+    start := len(dst)
+    dst, err := appendHeader(dst, size, md.SubscriptionMode, md.ExchangeType, md.Token)
+    if err != nil {
+        return dst, err
+    }
+    frame := dst[start:]
+
+    putInt64(frame, offsetSequenceNumber, md.SequenceNumber)
+    putInt64(frame, offsetExchangeTimestamp, md.ExchangeTimestamp)
+    putInt64(frame, offsetLastTradedPrice, md.LastTradedPrice)
+
+    if md.SubscriptionMode >= 2 {
+        putInt64(frame, offsetLastTradedQuantity, md.LastTradedQuantity)
+        putInt64(frame, offsetAverageTradedPrice, md.AverageTradedPrice)
+        putInt64(frame, offsetVolumeTrade, md.VolumeTrade)
+        putFloat64(frame, offsetTotalBuyQuantity, md.TotalBuyQuantity)
+        putFloat64(frame, offsetTotalSellQuantity, md.TotalSellQuantity)
+        putInt64(frame, offsetOpenPrice, md.OpenPriceOfTheDay)
+        putInt64(frame, offsetHighPrice, md.HighPriceOfTheDay)
+        putInt64(frame, offsetLowPrice, md.LowPriceOfTheDay)
+        putInt64(frame, offsetClosedPrice, md.ClosedPrice)
+    }
+
+    if md.SubscriptionMode >= 3 {
+        putInt64(frame, offsetLastTradedTimestamp, md.LastTradedTimestamp)
+        putInt64(frame, offsetOpenInterest, md.OpenInterest)
+        putFloat64(frame, offsetOpenInterestChange, md.OpenInterestChange)
+
+        for i := range md.BestFiveBuy {
+            putBestFive(frame, offsetBestFive+i*bestFivePacketSize, BestFiveBuyFlag, &md.BestFiveBuy[i])
+        }
+        sellOffset := offsetBestFive + len(md.BestFiveBuy)*bestFivePacketSize
+        for i := range md.BestFiveSell {
+            putBestFive(frame, sellOffset+i*bestFivePacketSize, BestFiveSellFlag, &md.BestFiveSell[i])
+        }
+
+        putInt64(frame, offsetUpperCircuitLimit, md.UpperCircuitLimit)
+        putInt64(frame, offsetLowerCircuitLimit, md.LowerCircuitLimit)
+        putInt64(frame, offsetFiftyTwoWeekHigh, md.FiftyTwoWeekHigh)
+        putInt64(frame, offsetFiftyTwoWeekLow, md.FiftyTwoWeekLow)
+    }
+
+    return dst, nil
+}
+
+// EncodeDepthData serializes d into a depth-20 frame. See AppendDepthData.
+func EncodeDepthData(d *DepthData) ([]byte, error) {
+    return AppendDepthData(nil, d)
+}
+
+// AppendDepthData appends the wire encoding of d to dst. The subscription mode
+// is always written as models.DepthMode, so decoding the result yields d back
+// as long as d.SubscriptionMode is DepthMode.
+func AppendDepthData(dst []byte, d *DepthData) ([]byte, error) {
+    start := len(dst)
+    dst, err := appendHeader(dst, DepthPacketSize, models.DepthMode, d.ExchangeType, d.Token)
+    if err != nil {
+        return dst, err
+    }
+    frame := dst[start:]
+
+    putInt64(frame, offsetDepthReceivedTime, d.PacketReceivedTime)
+    for i := range d.Buy {
+        putDepthEntry(frame, offsetDepthBuy+i*depthEntrySize, &d.Buy[i])
+    }
+    for i := range d.Sell {
+        putDepthEntry(frame, offsetDepthSell+i*depthEntrySize, &d.Sell[i])
+    }
+
+    return dst, nil
+}
+
+// appendHeader grows dst by a zeroed frame of size bytes and writes the mode,
+// exchange and null padded token.
+func appendHeader(dst []byte, size int, mode, exchange uint8, token string) ([]byte, error) {
+    if !knownExchange(exchange) {
+        return dst, fmt.Errorf("%w: %d", ErrUnknownExchange, exchange)
+    }
+    if len(token) > tokenSize {
+        return dst, fmt.Errorf("%w: %q", ErrTokenTooLong, token)
+    }
+
+    start := len(dst)
+    dst = append(dst, make([]byte, size)...)
+    frame := dst[start:]
+    frame[0] = mode
+    frame[1] = exchange
+    copy(frame[offsetToken:offsetToken+tokenSize], token)
+
+    return dst, nil
+}
+
+func putInt64(frame []byte, off int, v int64) {
+    binary.LittleEndian.PutUint64(frame[off:], uint64(v))
+}
+
+func putFloat64(frame []byte, off int, v float64) {
+    binary.LittleEndian.PutUint64(frame[off:], math.Float64bits(v))
+}
+
+func putBestFive(frame []byte, off int, flag uint16, b *BestFiveData) {
+    binary.LittleEndian.PutUint16(frame[off:], flag)
+    putInt64(frame, off+2, b.Quantity)
+    putInt64(frame, off+10, b.Price)
+    binary.LittleEndian.PutUint16(frame[off+18:], b.NumberOfOrders)
+}
+
+func putDepthEntry(frame []byte, off int, e *DepthEntry) {
+    binary.LittleEndian.PutUint32(frame[off:], uint32(e.Quantity))
+    binary.LittleEndian.PutUint32(frame[off+4:], uint32(e.Price))
+    binary.LittleEndian.PutUint16(frame[off+8:], uint16(e.NumberOfOrders))
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+    "bytes"
+    "errors"
+    "testing"
+)
+
+func TestEncodeMarketDataRoundTrip(t *testing.T) {
+    frame := snapQuoteFrame()
+    for _, mode := range []uint8{1, 2, 3} {
+        size, _ := PacketSize(mode)
+        data := append([]byte(nil), frame[:size]...)
+        data[0] = mode
+
+        md, err := ParseBinaryData(data)
+        if err != nil {
+            t.Fatalf("ParseBinaryData(mode %d): %v", mode, err)
+        }
+
+        encoded, err := EncodeMarketData(md)
+        if err != nil {
+            t.Fatalf("EncodeMarketData(mode %d): %v", mode, err)
+        }
+        if !bytes.Equal(encoded, data) {
+            t.Errorf("mode %d: re-encoded frame differs from original", mode)
+        }
+
+        decoded, err := ParseBinaryData(encoded)
+        if err != nil {
+            t.Fatalf("ParseBinaryData(encoded mode %d): %v", mode, err)
+        }
+        if *decoded != *md {
+            t.Errorf("mode %d: round trip gave %+v, want %+v", mode, *decoded, *md)
+        }
+    }
+}
+
+func TestEncodeDepthDataRoundTrip(t *testing.T) {
+    want := &DepthData{
+        SubscriptionMode:   4,
+        ExchangeType:       2,
+        Token:              "43607",
+        PacketReceivedTime: 1736912345123,
+    }
+    for i := 0; i < DepthLevels; i++ {
+        want.Buy[i] = DepthEntry{Quantity: int32(75 * (i + 1)), Price: int32(12000 - 5*i), NumberOfOrders: int16(i + 1)}
+        want.Sell[i] = DepthEntry{Quantity: int32(50 * (i + 1)), Price: int32(12005 + 5*i), NumberOfOrders: int16(i + 2)}
+    }
+
+    frame, err := EncodeDepthData(want)
+    if err != nil {
+        t.Fatalf("EncodeDepthData: %v", err)
+    }
+    if len(frame) != DepthPacketSize {
+        t.Fatalf("depth frame has %d bytes, want %d", len(frame), DepthPacketSize)
+    }
+
+    got, err := ParseDepthData(frame)
+    if err != nil {
+        t.Fatalf("ParseDepthData: %v", err)
+    }
+    if *got != *want {
+        t.Errorf("round trip gave %+v, want %+v", *got, *want)
+    }
+}
+
+func TestAppendMarketDataAppendsFrames(t *testing.T) {
+    ltp := &MarketData{SubscriptionMode: 1, ExchangeType: 1, Token: "2885", LastTradedPrice: 128550}
+    quote := &MarketData{SubscriptionMode: 2, ExchangeType: 13, Token: "1154", LastTradedPrice: 832150000}
+
+    buf, err := AppendMarketData(nil, ltp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    buf, err = AppendMarketData(buf, quote)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(buf) != LTPPacketSize+QuotePacketSize {
+        t.Fatalf("buffer has %d bytes, want %d", len(buf), LTPPacketSize+QuotePacketSize)
+    }
+
+    var md MarketData
+    if err := DecodeMarketData(buf[LTPPacketSize:], &md); err != nil {
+        t.Fatal(err)
+    }
+    if md != *quote {
+        t.Errorf("second frame decoded as %+v, want %+v", md, *quote)
+    }
+}
+
+func TestEncodeMarketDataRejectsInvalidInput(t *testing.T) {
+    cases := []struct {
+        name string
+        md   MarketData
+        want error
+    }{
+        {"unknown mode", MarketData{SubscriptionMode: 9, ExchangeType: 1, Token: "2885"}, ErrUnknownMode},
+        {"depth mode", MarketData{SubscriptionMode: 4, ExchangeType: 1, Token: "2885"}, ErrUnknownMode},
+        {"unknown exchange", MarketData{SubscriptionMode: 1, ExchangeType: 6, Token: "2885"}, ErrUnknownExchange},
+        {"long token", MarketData{SubscriptionMode: 1, ExchangeType: 1, Token: "12345678901234567890123456"}, ErrTokenTooLong},
+    }
+    for _, tc := range cases {
+        if _, err := EncodeMarketData(&tc.md); !errors.Is(err, tc.want) {
+            t.Errorf("%s: got error %v, want %v", tc.name, err, tc.want)
+        }
+    }
+}
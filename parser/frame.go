@@ -0,0 +1,136 @@
+package parser
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+
+    "angelone_clickhouse/models"
+)
+
+// Packet sizes in bytes for each subscription mode
+const (
+    LTPPacketSize       = 51
+    QuotePacketSize     = 123
+    SnapQuotePacketSize = 379
+    DepthPacketSize     = 443
+
+    // Subscription mode and exchange type bytes
+    frameHeaderSize = 2
+    tokenSize       = 25
+)
+
+var (
+    ErrShortFrame      = errors.New("short frame")
+    ErrUnknownMode     = errors.New("unknown subscription mode")
+    ErrUnknownExchange = errors.New("unknown exchange type")
+)
+
+// FrameError describes a frame rejected by the parser. It unwraps to one of
+// ErrShortFrame, ErrUnknownMode or ErrUnknownExchange.
+type FrameError struct {
+    Err      error
+    Mode     uint8
+    Exchange uint8
+    Length   int
+    Expected int
+}
+
+func (e *FrameError) Error() string {
+    if errors.Is(e.Err, ErrShortFrame) {
+        return fmt.Sprintf("%v: mode %d frame has %d bytes, expected %d", e.Err, e.Mode, e.Length, e.Expected)
+    }
+    return fmt.Sprintf("%v: mode %d, exchange %d, %d bytes", e.Err, e.Mode, e.Exchange, e.Length)
+}
+
+func (e *FrameError) Unwrap() error {
+    return e.Err
+}
+
+// FrameErrorReason maps a parse error to a short label for metrics
+func FrameErrorReason(err error) string {
+    switch {
+    case errors.Is(err, ErrShortFrame):
+        return "short_frame"
+    case errors.Is(err, ErrUnknownMode):
+        return "unknown_mode"
+    case errors.Is(err, ErrUnknownExchange):
+        return "unknown_exchange"
+    }
+    return "decode_error"
+}
+
+// PacketSize returns the frame length the feed sends for a subscription mode
+func PacketSize(mode uint8) (int, bool) {
+    switch mode {
+    case models.LtpMode:
+        return LTPPacketSize, true
+    case models.QuoteMode:
+        return QuotePacketSize, true
+    case models.SnapQuote:
+        return SnapQuotePacketSize, true
+    case models.DepthMode:
+        return DepthPacketSize, true
+    }
+    return 0, false
+}
+
+// ValidateFrame checks that a frame declares a known mode and exchange and is
+// long enough for the declared mode, returning the mode on success.
+func ValidateFrame(data []byte) (uint8, error) {
+    if len(data) < frameHeaderSize {
+        return 0, &FrameError{Err: ErrShortFrame, Length: len(data), Expected: frameHeaderSize}
+    }
+
+    mode, exchange := data[0], data[1]
+    expected, ok := PacketSize(mode)
+    if !ok {
+        return mode, &FrameError{Err: ErrUnknownMode, Mode: mode, Exchange: exchange, Length: len(data)}
+    }
+    if !knownExchange(exchange) {
+        return mode, &FrameError{Err: ErrUnknownExchange, Mode: mode, Exchange: exchange, Length: len(data)}
+    }
+    if len(data) < expected {
+        return mode, &FrameError{Err: ErrShortFrame, Mode: mode, Exchange: exchange, Length: len(data), Expected: expected}
+    }
+
+    return mode, nil
+}
+
+// Lookup table of exchange types from models.ExchangeMap, kept as an array so
+// validation stays cheap on the hot path
+var knownExchanges = func() (known [256]bool) {
+    for _, exchange := range models.ExchangeMap {
+        known[exchange] = true
+    }
+    return known
+}()
+
+func knownExchange(exchange uint8) bool {
+    return knownExchanges[exchange]
+}
+
+// frameReader wraps binary.Read and keeps the first error so a sequence of
+// reads can be checked once at the end.
+type frameReader struct {
+    r   *bytes.Reader
+    err error
+}
+
+func newFrameReader(data []byte) *frameReader {
+    return &frameReader{r: bytes.NewReader(data)}
+}
+
+func (fr *frameReader) read(v interface{}) {
+    if fr.err != nil {
+        return
+    }
+    fr.err = binary.Read(fr.r, binary.LittleEndian, v)
+}
+
+func (fr *frameReader) readToken() string {
+    tokenBytes := make([]byte, tokenSize)
+    fr.read(tokenBytes)
+    return string(bytes.TrimRight(tokenBytes, "\x00"))
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+    "errors"
+    "testing"
+
+    "angelone_clickhouse/models"
+)
+
+func frameOf(mode, exchange uint8, length int) []byte {
+    frame := make([]byte, length)
+    if length > 0 {
+        frame[0] = mode
+    }
+    if length > 1 {
+        frame[1] = exchange
+    }
+    return frame
+}
+
+func TestValidateFrame(t *testing.T) {
+    tests := []struct {
+        name     string
+        frame    []byte
+        want     error
+        expected int
+    }{
+        {"empty", nil, ErrShortFrame, frameHeaderSize},
+        {"header only", []byte{models.LtpMode}, ErrShortFrame, frameHeaderSize},
+        {"short LTP", frameOf(models.LtpMode, models.NSE_CM, LTPPacketSize-1), ErrShortFrame, LTPPacketSize},
+        {"short Quote", frameOf(models.QuoteMode, models.NSE_CM, QuotePacketSize-1), ErrShortFrame, QuotePacketSize},
+        {"short SnapQuote", frameOf(models.SnapQuote, models.NSE_FO, SnapQuotePacketSize-1), ErrShortFrame, SnapQuotePacketSize},
+        {"short Depth", frameOf(models.DepthMode, models.NSE_CM, DepthPacketSize-1), ErrShortFrame, DepthPacketSize},
+        {"Quote frame declared as SnapQuote", frameOf(models.SnapQuote, models.NSE_CM, QuotePacketSize), ErrShortFrame, SnapQuotePacketSize},
+        {"mode 0", frameOf(0, models.NSE_CM, SnapQuotePacketSize), ErrUnknownMode, 0},
+        {"mode 5", frameOf(5, models.NSE_CM, SnapQuotePacketSize), ErrUnknownMode, 0},
+        {"exchange 0", frameOf(models.LtpMode, 0, LTPPacketSize), ErrUnknownExchange, 0},
+        {"exchange 6", frameOf(models.LtpMode, 6, LTPPacketSize), ErrUnknownExchange, 0},
+        {"valid LTP", frameOf(models.LtpMode, models.NSE_CM, LTPPacketSize), nil, 0},
+        {"valid CDE_FO Quote", frameOf(models.QuoteMode, models.CDE_FO, QuotePacketSize), nil, 0},
+        {"valid Depth", frameOf(models.DepthMode, models.MCX_FO, DepthPacketSize), nil, 0},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ValidateFrame(tt.frame)
+            if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+                t.Fatalf("ValidateFrame = %v, want %v", err, tt.want)
+            }
+            if err == nil {
+                return
+            }
+
+            var frameErr *FrameError
+            if !errors.As(err, &frameErr) {
+                t.Fatalf("error %v is not a *FrameError", err)
+            }
+            if frameErr.Length != len(tt.frame) || frameErr.Expected != tt.expected {
+                t.Errorf("length %d, expected %d; want %d and %d", frameErr.Length, frameErr.Expected, len(tt.frame), tt.expected)
+            }
+        })
+    }
+}
+
+func TestParsersRejectInvalidFrames(t *testing.T) {
+    var md MarketData
+    tests := []struct {
+        name   string
+        parse  func([]byte) error
+        frame  []byte
+        want   error
+        reason string
+    }{
+        {"ParseBinaryData rejects depth mode", parseBinary, depthFrame(), ErrUnknownMode, "unknown_mode"},
+        {"ParseBinaryData rejects short SnapQuote", parseBinary, snapQuoteFrame()[:QuotePacketSize], ErrShortFrame, "short_frame"},
+        {"DecodeMarketData rejects depth mode", func(b []byte) error { return DecodeMarketData(b, &md) }, depthFrame(), ErrUnknownMode, "unknown_mode"},
+        {"DecodeMarketData rejects unknown exchange", func(b []byte) error { return DecodeMarketData(b, &md) }, frameOf(models.LtpMode, 6, LTPPacketSize), ErrUnknownExchange, "unknown_exchange"},
+        {"ParseDepthData rejects tick modes", parseDepth, snapQuoteFrame(), ErrUnknownMode, "unknown_mode"},
+        {"ParseDepthData rejects short frames", parseDepth, depthFrame()[:DepthPacketSize-10], ErrShortFrame, "short_frame"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := tt.parse(tt.frame)
+            if !errors.Is(err, tt.want) {
+                t.Fatalf("got %v, want %v", err, tt.want)
+            }
+            if reason := FrameErrorReason(err); reason != tt.reason {
+                t.Errorf("FrameErrorReason = %q, want %q", reason, tt.reason)
+            }
+        })
+    }
+}
+
+func parseBinary(frame []byte) error {
+    _, err := ParseBinaryData(frame)
+    return err
+}
+
+func parseDepth(frame []byte) error {
+    _, err := ParseDepthData(frame)
+    return err
+}
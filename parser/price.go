@@ -0,0 +1,36 @@
+package parser
+
+import "angelone_clickhouse/models"
+
+// DefaultPriceDivisor converts prices sent in paise to rupees
+const DefaultPriceDivisor = 100.0
+
+// CurrencyPriceDivisor is used for currency derivatives, which the feed sends
+// with seven implied decimal places
+const CurrencyPriceDivisor = 10000000.0
+
+// Per exchange divisors indexed by exchange type; zero means DefaultPriceDivisor
+var priceDivisors = func() (divisors [256]float64) {
+    divisors[models.CDE_FO] = CurrencyPriceDivisor
+    return divisors
+}()
+
+// SetPriceDivisor overrides the divisor used to scale raw prices for an exchange.
+// It is not safe to call while frames are being decoded and is meant to be
+// applied once from configuration at startup.
+func SetPriceDivisor(exchangeType uint8, divisor float64) {
+    priceDivisors[exchangeType] = divisor
+}
+
+// PriceDivisor returns the divisor applied to raw prices from an exchange
+func PriceDivisor(exchangeType uint8) float64 {
+    if divisor := priceDivisors[exchangeType]; divisor > 0 {
+        return divisor
+    }
+    return DefaultPriceDivisor
+}
+
+// ScalePrice converts a raw integer price from the feed into a decimal price
+func ScalePrice(exchangeType uint8, raw int64) float64 {
+    return float64(raw) / PriceDivisor(exchangeType)
+}
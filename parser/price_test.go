@@ -0,0 +1,95 @@
+package parser
+
+import (
+    "testing"
+
+    "angelone_clickhouse/models"
+)
+
+// overrideDivisor sets a divisor for the rest of the test
+func overrideDivisor(t *testing.T, exchangeType uint8, divisor float64) {
+    previous := priceDivisors[exchangeType]
+    SetPriceDivisor(exchangeType, divisor)
+    t.Cleanup(func() { SetPriceDivisor(exchangeType, previous) })
+}
+
+func TestScalePriceDefaults(t *testing.T) {
+    tests := []struct {
+        exchange uint8
+        raw      int64
+        want     float64
+    }{
+        {models.NSE_CM, 250050, 2500.50},
+        {models.NSE_FO, 12345, 123.45},
+        {models.MCX_FO, 6150000, 61500},
+        {models.CDE_FO, 832150000, 83.215},
+        {models.BSE_CM, -150, -1.5},
+    }
+    for _, tt := range tests {
+        if got := ScalePrice(tt.exchange, tt.raw); got != tt.want {
+            t.Errorf("ScalePrice(%d, %d) = %v, want %v", tt.exchange, tt.raw, got, tt.want)
+        }
+    }
+    if got := PriceDivisor(models.CDE_FO); got != CurrencyPriceDivisor {
+        t.Errorf("CDE_FO divisor = %v, want %v", got, CurrencyPriceDivisor)
+    }
+}
+
+func TestSetPriceDivisor(t *testing.T) {
+    overrideDivisor(t, models.MCX_FO, 10000)
+    if got := ScalePrice(models.MCX_FO, 6150000); got != 615 {
+        t.Errorf("overridden MCX_FO price = %v, want 615", got)
+    }
+    if got := ScalePrice(models.NSE_CM, 250050); got != 2500.50 {
+        t.Errorf("NSE_CM price = %v after overriding MCX_FO, want 2500.50", got)
+    }
+
+    // A divisor that is not positive falls back to the default
+    overrideDivisor(t, models.BSE_CM, 0)
+    if got := PriceDivisor(models.BSE_CM); got != DefaultPriceDivisor {
+        t.Errorf("zero divisor: got %v, want %v", got, DefaultPriceDivisor)
+    }
+}
+
+func TestPricesShareTheDivisorTable(t *testing.T) {
+    overrideDivisor(t, models.NSE_FO, 1000)
+
+    md := &MarketData{
+        ExchangeType:      models.NSE_FO,
+        LastTradedPrice:   123450,
+        UpperCircuitLimit: 135000,
+        LowerCircuitLimit: 111000,
+        FiftyTwoWeekHigh:  150000,
+        FiftyTwoWeekLow:   90000,
+    }
+    md.BestFiveBuy[0].Price = 123400
+
+    for _, tt := range []struct {
+        name string
+        got  float64
+        want float64
+    }{
+        {"last traded", md.GetLastTradedPrice(), 123.45},
+        {"upper circuit", md.GetUpperCircuitLimit(), 135},
+        {"lower circuit", md.GetLowerCircuitLimit(), 111},
+        {"52-week high", md.GetFiftyTwoWeekHigh(), 150},
+        {"52-week low", md.GetFiftyTwoWeekLow(), 90},
+        {"best five", md.GetBestFivePrice(&md.BestFiveBuy[0]), 123.4},
+    } {
+        if tt.got != tt.want {
+            t.Errorf("%s price = %v, want %v", tt.name, tt.got, tt.want)
+        }
+    }
+
+    depth := &DepthData{ExchangeType: models.NSE_FO}
+    depth.Buy[0].Price = 123450
+    if got := depth.GetPrice(&depth.Buy[0]); got != 123.45 {
+        t.Errorf("depth price = %v, want 123.45", got)
+    }
+
+    depth.ExchangeType = models.CDE_FO
+    depth.Sell[0].Price = 832150000
+    if got := depth.GetPrice(&depth.Sell[0]); got != 83.215 {
+        t.Errorf("CDE_FO depth price = %v, want 83.215", got)
+    }
+}
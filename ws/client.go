@@ -1,126 +1,456 @@
 package ws
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 const (
-	HeartbeatInterval = 10 * time.Second
-	ReconnectDelay    = 5 * time.Second
+	HeartbeatInterval  = 10 * time.Second
+	ReconnectDelay     = 5 * time.Second
+	DefaultPongTimeout = 30 * time.Second
+
+	writeTimeout = 10 * time.Second
+	drainTimeout = 2 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("websocket is not connected")
+	ErrDraining     = errors.New("websocket is shutting down")
+)
+
+// State is the lifecycle state of a WebSocketClient
+type State int32
+
+const (
+	// StateConnecting covers dialling and restoring subscriptions
+	StateConnecting State = iota
+	// StateSubscribed means the connection is up and subscriptions are active
+	StateSubscribed
+	// StateDraining means shutdown was requested and the connection is closing
+	StateDraining
+	// StateClosed is final; Listen has returned
+	StateClosed
 )
 
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateSubscribed:
+		return "subscribed"
+	case StateDraining:
+		return "draining"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("state(%d)", int32(s))
+}
+
+// WebSocketClient maintains a SmartStream connection. Listen owns the
+// connection lifecycle: it dials, restores subscriptions, reads frames and
+// redials on failure until its context is cancelled. All writes to a
+// connection go through a single writer goroutine.
 type WebSocketClient struct {
-	conn           *websocket.Conn
-	url            string
-	OnMessage      func([]byte)
-	isConnected    bool
-	reconnectDelay time.Duration
-	Headers        map[string]string
+	url     string
+	Headers map[string]string
+	// HeaderFunc, when set, supplies the headers for every dial instead of
+	// Headers, so credentials refreshed between reconnects are picked up
+	HeaderFunc func() map[string]string
+
+	// OnTick receives binary market data frames
+	OnTick func([]byte)
+	// OnError receives JSON error responses sent by the server
+	OnError func(*ServerError)
+	// OnResubscribe is called after a reconnect with the number of tokens restored
+	OnResubscribe func(tokens int)
+	// OnStateChange is called on every state transition
+	OnStateChange func(State)
+
+	// PongTimeout is how long the connection may go without a "pong" before
+	// it is considered stale and torn down
+	PongTimeout time.Duration
+
+	reconnectDelay    time.Duration
+	heartbeatInterval time.Duration
+	state             atomic.Int32
+
+	// Unix nanoseconds of the last connect, "pong" and binary tick
+	connectedAt atomic.Int64
+	lastPong    atomic.Int64
+	lastTick    atomic.Int64
+
+	sessionMu sync.Mutex
+	session   *session
+
+	// CorrelationID is sent with every subscription request
+	CorrelationID string
+
+	// Subscription set replayed on every new connection
+	subMu         sync.Mutex
+	subscriptions map[subscription]struct{}
+}
+
+// session is a single dialled connection and its writer goroutine
+type session struct {
+	conn      *websocket.Conn
+	writes    chan writeRequest
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type writeRequest struct {
+	messageType int
+	data        []byte
+	result      chan error
 }
 
 func NewWebSocketClient(url string, headers map[string]string) *WebSocketClient {
 	return &WebSocketClient{
 		url:            url,
 		Headers:        headers,
-		reconnectDelay: 5 * time.Second,
+		PongTimeout:    DefaultPongTimeout,
+		CorrelationID:  DefaultCorrelationID,
+		reconnectDelay: ReconnectDelay,
+		subscriptions:  make(map[subscription]struct{}),
+
+		heartbeatInterval: HeartbeatInterval,
 	}
 }
 
-func (c *WebSocketClient) Connect() error {
+// State returns the current lifecycle state
+func (c *WebSocketClient) State() State {
+	return State(c.state.Load())
+}
+
+func (c *WebSocketClient) setState(state State) {
+	if State(c.state.Swap(int32(state))) != state {
+		c.notifyState(state)
+	}
+}
+
+// transition moves from one state to another only if the client is still in
+// from, so a shutdown that started concurrently is not overwritten
+func (c *WebSocketClient) transition(from, to State) bool {
+	if !c.state.CompareAndSwap(int32(from), int32(to)) {
+		return false
+	}
+	c.notifyState(to)
+	return true
+}
+
+// notifyState reports a state change to OnStateChange. It must not be called
+// with subMu held.
+func (c *WebSocketClient) notifyState(state State) {
+	if c.OnStateChange != nil {
+		c.OnStateChange(state)
+	}
+}
+
+// Listen connects and processes frames until ctx is cancelled, redialling
+// and restoring subscriptions whenever the connection drops. On cancellation
+// it drains the current connection with a close frame and returns.
+func (c *WebSocketClient) Listen(ctx context.Context) {
+	defer c.setState(StateClosed)
+
+	reconnect := false
+	for ctx.Err() == nil {
+		c.setState(StateConnecting)
+
+		s, err := c.dial(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Connection failed: %v, retrying in %v", err, c.reconnectDelay)
+		} else {
+			c.serve(ctx, s, reconnect)
+			reconnect = true
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Connection lost, reconnecting in %v", c.reconnectDelay)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.reconnectDelay):
+		}
+	}
+}
+
+func (c *WebSocketClient) dial(ctx context.Context) (*session, error) {
 	dialer := websocket.Dialer{
 		HandshakeTimeout: 5 * time.Second,
 	}
 
 	// Add headers to connection request
-	conn, _, err := dialer.Dial(c.url, c.getHttpHeaders())
+	conn, _, err := dialer.DialContext(ctx, c.url, c.getHttpHeaders())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.conn = conn
-	c.isConnected = true
+	c.connectedAt.Store(time.Now().UnixNano())
+
+	return &session{
+		conn:   conn,
+		writes: make(chan writeRequest),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// serve runs one connection until it fails or ctx is cancelled
+func (c *WebSocketClient) serve(ctx context.Context, s *session, reconnect bool) {
+	c.sessionMu.Lock()
+	c.session = s
+	c.sessionMu.Unlock()
+
+	// Leave StateSubscribed as soon as the connection is gone, not when the
+	// next dial starts, so IsConnected is false for the reconnect delay
+	defer func() {
+		c.transition(StateSubscribed, StateConnecting)
+		s.close()
+		c.sessionMu.Lock()
+		if c.session == s {
+			c.session = nil
+		}
+		c.sessionMu.Unlock()
+	}()
+
+	go s.writeLoop()
+	go c.heartbeat(s)
+
+	stopDrain := context.AfterFunc(ctx, func() { c.drain(s) })
+	defer stopDrain()
 
-	// Start heartbeat
-	go c.heartbeat()
+	// A new connection starts without subscriptions
+	if err := c.resubscribe(s, reconnect); err != nil {
+		log.Printf("%v", err)
+		return
+	}
 
-	return nil
+	for {
+		messageType, message, err := s.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error reading message: %v", err)
+			}
+			return
+		}
+
+		c.dispatch(messageType, message)
+	}
+}
+
+// drain sends a close frame and gives the server a moment to acknowledge it
+// before the connection is torn down, which unblocks the read loop in serve
+func (c *WebSocketClient) drain(s *session) {
+	c.setState(StateDraining)
+
+	closeFrame := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := s.write(websocket.CloseMessage, closeFrame); err != nil {
+		s.close()
+		return
+	}
+
+	select {
+	case <-s.done:
+	case <-time.After(drainTimeout):
+		s.close()
+	}
 }
 
 func (c *WebSocketClient) getHttpHeaders() http.Header {
+	source := c.Headers
+	if c.HeaderFunc != nil {
+		source = c.HeaderFunc()
+	}
+
 	headers := http.Header{}
-	for key, value := range c.Headers {
+	for key, value := range source {
 		headers.Set(key, value)
 	}
 	return headers
 }
 
-func (c *WebSocketClient) heartbeat() {
-	ticker := time.NewTicker(HeartbeatInterval)
-	defer ticker.Stop()
-
+// writeLoop is the only goroutine that writes frames to the connection
+func (s *session) writeLoop() {
 	for {
-		<-ticker.C
-		if err := c.conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
-			log.Printf("Failed to send heartbeat: %v", err)
-			c.reconnect()
+		select {
+		case req := <-s.writes:
+			s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err := s.conn.WriteMessage(req.messageType, req.data)
+			req.result <- err
+			if err != nil {
+				s.close()
+				return
+			}
+		case <-s.done:
 			return
 		}
 	}
 }
 
-func (c *WebSocketClient) reconnect() {
-	c.isConnected = false
-	c.conn.Close()
-	time.Sleep(c.reconnectDelay)
+// write queues a frame for the writer goroutine and waits for the result
+func (s *session) write(messageType int, data []byte) error {
+	req := writeRequest{
+		messageType: messageType,
+		data:        data,
+		result:      make(chan error, 1),
+	}
 
-	for !c.isConnected {
-		if err := c.Connect(); err != nil {
-			log.Printf("Reconnection failed: %v", err)
-			time.Sleep(c.reconnectDelay)
-			continue
-		}
+	select {
+	case s.writes <- req:
+	case <-s.done:
+		return ErrNotConnected
 	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-s.done:
+		return ErrNotConnected
+	}
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
 }
 
-func (c *WebSocketClient) Listen() {
+// heartbeat pings the connection and tears it down when a write fails or no
+// "pong" has arrived within PongTimeout, which makes serve return and Listen
+// redial. The wait is measured from the first ping of the session, so a
+// connection is never judged stale before it has been asked for a pong.
+func (c *WebSocketClient) heartbeat(s *session) {
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+
+	var firstPing time.Time
 	for {
-		if !c.isConnected {
-			if err := c.Connect(); err != nil {
-				log.Printf("Connection failed: %v, retrying in %v", err, c.reconnectDelay)
-				time.Sleep(c.reconnectDelay)
-				continue
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		if !firstPing.IsZero() {
+			since := firstPing
+			if pong := c.LastPong(); pong.After(since) {
+				since = pong
+			}
+			if age := time.Since(since); age > c.PongTimeout {
+				log.Printf("No pong received for %v, closing stale connection", age.Round(time.Millisecond))
+				s.close()
+				return
 			}
 		}
 
-		_, message, err := c.conn.ReadMessage()
-		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			c.isConnected = false
-			c.conn.Close()
-			continue
+		if err := s.write(websocket.TextMessage, []byte("ping")); err != nil {
+			log.Printf("Failed to send heartbeat: %v", err)
+			s.close()
+			return
+		}
+		if firstPing.IsZero() {
+			firstPing = time.Now()
+		}
+	}
+}
+
+// dispatch routes binary frames to OnTick and text frames to the heartbeat
+// tracker or OnError
+func (c *WebSocketClient) dispatch(messageType int, message []byte) {
+	if messageType == websocket.BinaryMessage {
+		c.lastTick.Store(time.Now().UnixNano())
+		if c.OnTick != nil {
+			c.OnTick(message)
 		}
+		return
+	}
+
+	text := bytes.TrimSpace(message)
+	if string(text) == "pong" {
+		c.lastPong.Store(time.Now().UnixNano())
+		return
+	}
 
-		if c.OnMessage != nil {
-			c.OnMessage(message)
+	var serverErr ServerError
+	if err := json.Unmarshal(text, &serverErr); err == nil && serverErr.ErrorCode != "" {
+		if c.OnError != nil {
+			c.OnError(&serverErr)
+		} else {
+			log.Printf("WebSocket %v", &serverErr)
 		}
+		return
+	}
+
+	log.Printf("Ignoring unexpected text message: %q", text)
+}
+
+// LastPong returns when the last "pong" was received, or the zero time if none has been
+func (c *WebSocketClient) LastPong() time.Time {
+	return unixNanoTime(c.lastPong.Load())
+}
+
+// LastTick returns when the last binary frame was received, or the zero time if none has been
+func (c *WebSocketClient) LastTick() time.Time {
+	return unixNanoTime(c.lastTick.Load())
+}
+
+// LastPongAge returns the time since the last "pong", measured from the
+// current connection's start if it has not received one yet
+func (c *WebSocketClient) LastPongAge() time.Duration {
+	since := c.lastPong.Load()
+	if connected := c.connectedAt.Load(); connected > since {
+		since = connected
+	}
+	if since == 0 {
+		return 0
 	}
+	return time.Since(time.Unix(0, since))
+}
+
+// IsConnected reports whether the client is connected with active subscriptions
+func (c *WebSocketClient) IsConnected() bool {
+	return c.State() == StateSubscribed
 }
 
-func (c *WebSocketClient) Close() {
-	if c.conn != nil {
-		c.conn.Close()
+func unixNanoTime(nanos int64) time.Time {
+	if nanos > 0 {
+		return time.Unix(0, nanos)
 	}
+	return time.Time{}
 }
 
-// Add SendJSON method
+// SendJSON encodes v and sends it over the current connection
 func (c *WebSocketClient) SendJSON(v interface{}) error {
-	if !c.isConnected {
-		return fmt.Errorf("websocket is not connected")
+	switch c.State() {
+	case StateDraining, StateClosed:
+		return ErrDraining
+	}
+
+	c.sessionMu.Lock()
+	s := c.session
+	c.sessionMu.Unlock()
+	if s == nil {
+		return ErrNotConnected
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
 	}
-	return c.conn.WriteJSON(v)
+	return s.write(websocket.TextMessage, data)
 }
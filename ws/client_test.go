@@ -0,0 +1,225 @@
+package ws
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer is a local SmartStream stand-in. Every accepted connection is
+// sent on conns and every text frame other than "ping" on messages. Pings
+// are answered only when pong is set.
+type testServer struct {
+	*httptest.Server
+	conns    chan *websocket.Conn
+	messages chan string
+	headers  chan http.Header
+	pong     bool
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	ts := &testServer{
+		conns:    make(chan *websocket.Conn, 8),
+		messages: make(chan string, 64),
+		headers:  make(chan http.Header, 8),
+	}
+	upgrader := websocket.Upgrader{}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		ts.headers <- r.Header
+		ts.conns <- conn
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType != websocket.TextMessage {
+				continue
+			}
+			if string(message) != "ping" {
+				ts.messages <- string(message)
+			} else if ts.pong {
+				conn.WriteMessage(websocket.TextMessage, []byte("pong"))
+			}
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// URL returns the ws:// address of the server
+func (ts *testServer) URL() string {
+	return "ws" + strings.TrimPrefix(ts.Server.URL, "http")
+}
+
+// runClient starts Listen and returns a channel of its state changes
+func runClient(t *testing.T, c *WebSocketClient) <-chan State {
+	t.Helper()
+	states := make(chan State, 16)
+	c.OnStateChange = func(s State) { states <- s }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Listen(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return states
+}
+
+func waitForState(t *testing.T, states <-chan State, want State) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case s := <-states:
+			if s == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %v", want)
+		}
+	}
+}
+
+func TestClientLeavesSubscribedWhenConnectionDrops(t *testing.T) {
+	server := newTestServer(t)
+
+	client := NewWebSocketClient(server.URL(), nil)
+	client.reconnectDelay = time.Hour
+	states := runClient(t, client)
+
+	waitForState(t, states, StateSubscribed)
+	if !client.IsConnected() {
+		t.Fatal("client should be connected once subscribed")
+	}
+
+	conn := <-server.conns
+	conn.Close()
+
+	waitForState(t, states, StateConnecting)
+	if client.IsConnected() {
+		t.Error("client reports connected while waiting to reconnect")
+	}
+	if got := client.State(); got != StateConnecting {
+		t.Errorf("state = %v, want %v", got, StateConnecting)
+	}
+}
+
+func TestClientRedialsWhenNoPongArrives(t *testing.T) {
+	server := newTestServer(t)
+
+	client := NewWebSocketClient(server.URL(), nil)
+	client.heartbeatInterval = 20 * time.Millisecond
+	client.PongTimeout = 50 * time.Millisecond
+	client.reconnectDelay = 10 * time.Millisecond
+	states := runClient(t, client)
+
+	// The stand-in never answers pings, so the first connection goes stale
+	waitForState(t, states, StateSubscribed)
+	<-server.conns
+	waitForState(t, states, StateConnecting)
+
+	select {
+	case <-server.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not redial after the connection went stale")
+	}
+	waitForState(t, states, StateSubscribed)
+}
+
+func TestClientKeepsConnectionThatAnswersPings(t *testing.T) {
+	server := newTestServer(t)
+	server.pong = true
+
+	client := NewWebSocketClient(server.URL(), nil)
+	client.heartbeatInterval = 20 * time.Millisecond
+	client.PongTimeout = 50 * time.Millisecond
+	states := runClient(t, client)
+
+	waitForState(t, states, StateSubscribed)
+	select {
+	case s := <-states:
+		t.Fatalf("state changed to %v while pongs were arriving", s)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestDispatchRoutesTextFrames(t *testing.T) {
+	server := newTestServer(t)
+
+	client := NewWebSocketClient(server.URL(), nil)
+	errs := make(chan *ServerError, 4)
+	ticks := make(chan []byte, 4)
+	client.OnError = func(err *ServerError) { errs <- err }
+	client.OnTick = func(message []byte) { ticks <- message }
+	states := runClient(t, client)
+
+	waitForState(t, states, StateSubscribed)
+	conn := <-server.conns
+
+	// Frames are dispatched in order, so a binary marker after the text
+	// frames under test shows they have been handled
+	send := func(messageType int, message string) {
+		t.Helper()
+		if err := conn.WriteMessage(messageType, []byte(message)); err != nil {
+			t.Fatalf("write %q: %v", message, err)
+		}
+	}
+	await := func(marker string) {
+		t.Helper()
+		send(websocket.BinaryMessage, marker)
+		select {
+		case tick := <-ticks:
+			if string(tick) != marker {
+				t.Fatalf("OnTick got %q, want %q", tick, marker)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", marker)
+		}
+	}
+
+	send(websocket.TextMessage, "pong\n")
+	await("after pong")
+	lastPong := client.LastPong()
+	if lastPong.IsZero() {
+		t.Fatal("pong did not update LastPong")
+	}
+
+	send(websocket.TextMessage, `{"correlationID":"abcde12345","errorCode":"E1002","errorMessage":"Invalid Request. Subscription Limit Exceeded"}`)
+	await("after error")
+	select {
+	case err := <-errs:
+		want := ServerError{CorrelationID: "abcde12345", ErrorCode: "E1002", ErrorMessage: "Invalid Request. Subscription Limit Exceeded"}
+		if *err != want {
+			t.Errorf("OnError got %+v, want %+v", *err, want)
+		}
+	default:
+		t.Fatal("server error was not passed to OnError")
+	}
+
+	send(websocket.TextMessage, "hello")
+	send(websocket.TextMessage, `{"status":true}`)
+	await("after unknown text")
+	select {
+	case err := <-errs:
+		t.Errorf("unknown text reached OnError as %+v", *err)
+	default:
+	}
+	if !client.LastPong().Equal(lastPong) {
+		t.Error("unknown text updated LastPong")
+	}
+}
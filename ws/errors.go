@@ -0,0 +1,21 @@
+package ws
+
+import "fmt"
+
+// Error codes returned by SmartStream in JSON error responses
+const (
+	ErrCodeInvalidRequest    = "E1001"
+	ErrCodeSubscriptionLimit = "E1002"
+)
+
+// ServerError is a JSON error response sent by the server as a text frame,
+// e.g. for an invalid token or when the subscription limit is exceeded.
+type ServerError struct {
+	CorrelationID string `json:"correlationID"`
+	ErrorCode     string `json:"errorCode"`
+	ErrorMessage  string `json:"errorMessage"`
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error %s: %s (correlation id %q)", e.ErrorCode, e.ErrorMessage, e.CorrelationID)
+}
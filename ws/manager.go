@@ -0,0 +1,459 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"angelone_clickhouse/angel"
+)
+
+// Limits published for SmartStream
+const (
+	DefaultMaxTokensPerConnection = 1000
+	DefaultMaxConnections         = 3
+)
+
+var ErrCapacityExceeded = errors.New("subscription capacity exceeded")
+
+// Manager shards subscriptions across several WebSocketClients so the token
+// universe can exceed the per-connection limit. All clients share the same
+// callbacks, which merges their streams into one pipeline. Every mode of a
+// token is kept on the same connection.
+type Manager struct {
+	url     string
+	headers map[string]string
+
+	// Limits applied when placing tokens
+	MaxTokensPerConnection int
+	MaxConnections         int
+
+	// Callbacks shared by every connection. They are read each time they are
+	// called, so they may be set after Subscribe, but not once Listen runs.
+	HeaderFunc    func() map[string]string
+	OnTick        func([]byte)
+	OnError       func(*ServerError)
+	OnResubscribe func(tokens int)
+	OnStateChange func(State)
+
+	// Settings copied to a connection when Subscribe opens it
+	PongTimeout   time.Duration
+	CorrelationID string
+
+	mu      sync.Mutex
+	shards  []*shard
+	owners  map[tokenKey]*shard
+	ctx     context.Context
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type shard struct {
+	client *WebSocketClient
+	cancel context.CancelFunc
+}
+
+type tokenKey struct {
+	exchangeType int
+	token        string
+}
+
+func NewManager(url string, headers map[string]string) *Manager {
+	return &Manager{
+		url:                    url,
+		headers:                headers,
+		MaxTokensPerConnection: DefaultMaxTokensPerConnection,
+		MaxConnections:         DefaultMaxConnections,
+		PongTimeout:            DefaultPongTimeout,
+		CorrelationID:          DefaultCorrelationID,
+		owners:                 make(map[tokenKey]*shard),
+	}
+}
+
+// Listen runs every connection until ctx is cancelled. Connections opened
+// later by Subscribe are started as they are created.
+func (m *Manager) Listen(ctx context.Context) {
+	m.mu.Lock()
+	m.ctx = ctx
+	for _, s := range m.shards {
+		m.start(s)
+	}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+// Subscribe adds tokens in mode. Tokens already owned by a connection stay
+// on it; new tokens go to the connection with the most free capacity, and a
+// new connection is opened when all are full.
+func (m *Manager) Subscribe(mode int, tokens []angel.TokenSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.subscribe(mode, flatten(mode, tokens))
+}
+
+// subscribe plans the placement of every token first so that a request that
+// does not fit changes nothing. Must be called with mu held.
+func (m *Manager) subscribe(mode int, subs []subscription) error {
+	pending := make(map[*shard][]subscription)
+	owners := make(map[tokenKey]*shard)
+	var opened []*shard
+	load := func(s *shard) int { return s.client.SubscriptionCount() + len(pending[s]) }
+
+	seen := make(map[subscription]bool)
+	for _, sub := range subs {
+		if seen[sub] {
+			continue
+		}
+		seen[sub] = true
+
+		key := tokenKey{sub.exchangeType, sub.token}
+		owner, ok := m.owners[key]
+		if !ok {
+			owner, ok = owners[key]
+		}
+		if ok {
+			if containsMode(owner.client.tokenModes(sub.exchangeType, sub.token), mode) {
+				continue
+			}
+			if load(owner) >= m.MaxTokensPerConnection {
+				return fmt.Errorf("%w: connection holding token %s is full", ErrCapacityExceeded, sub.token)
+			}
+			pending[owner] = append(pending[owner], sub)
+			continue
+		}
+
+		target := m.leastLoaded(append(m.shards[:len(m.shards):len(m.shards)], opened...), load)
+		if target == nil {
+			if len(m.shards)+len(opened) >= m.MaxConnections {
+				return fmt.Errorf("%w: %d connections of %d tokens", ErrCapacityExceeded, m.MaxConnections, m.MaxTokensPerConnection)
+			}
+			target = m.newShard()
+			opened = append(opened, target)
+		}
+		pending[target] = append(pending[target], sub)
+		owners[key] = target
+	}
+
+	// New connections are not started yet, so their subscriptions are only
+	// recorded; if any connection fails, the ones that succeeded are undone
+	var done []*shard
+	for s, subs := range pending {
+		if err := s.client.Subscribe(mode, groupByExchange(subs)); err != nil {
+			for _, d := range done {
+				if undoErr := d.client.Unsubscribe(mode, groupByExchange(pending[d])); undoErr != nil {
+					log.Printf("Failed to undo subscription: %v", undoErr)
+				}
+			}
+			return err
+		}
+		done = append(done, s)
+	}
+
+	for _, s := range opened {
+		m.addShard(s)
+	}
+	for key, owner := range owners {
+		m.owners[key] = owner
+	}
+
+	return nil
+}
+
+// Unsubscribe removes tokens from mode on the connections that hold them,
+// then closes or consolidates connections that are no longer needed
+func (m *Manager) Unsubscribe(mode int, tokens []angel.TokenSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byShard := make(map[*shard][]subscription)
+	for _, sub := range flatten(mode, tokens) {
+		if owner, ok := m.owners[tokenKey{sub.exchangeType, sub.token}]; ok {
+			byShard[owner] = append(byShard[owner], sub)
+		}
+	}
+
+	for s, subs := range byShard {
+		if err := s.client.Unsubscribe(mode, groupByExchange(subs)); err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if len(s.client.tokenModes(sub.exchangeType, sub.token)) == 0 {
+				delete(m.owners, tokenKey{sub.exchangeType, sub.token})
+			}
+		}
+	}
+
+	m.rebalance()
+	return nil
+}
+
+// ChangeMode moves tokens to mode on the connections that hold them.
+// Tokens not subscribed anywhere are subscribed as with Subscribe.
+func (m *Manager) ChangeMode(mode int, tokens []angel.TokenSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	byShard := make(map[*shard][]subscription)
+	var unowned []subscription
+	for _, sub := range flatten(mode, tokens) {
+		if owner, ok := m.owners[tokenKey{sub.exchangeType, sub.token}]; ok {
+			byShard[owner] = append(byShard[owner], sub)
+		} else {
+			unowned = append(unowned, sub)
+		}
+	}
+
+	for s, subs := range byShard {
+		if err := s.client.ChangeMode(mode, groupByExchange(subs)); err != nil {
+			return err
+		}
+	}
+
+	return m.subscribe(mode, unowned)
+}
+
+// rebalance closes empty connections and folds the least loaded connection
+// into the others when its tokens fit in their free capacity
+func (m *Manager) rebalance() {
+	for _, s := range append([]*shard(nil), m.shards...) {
+		if s.client.SubscriptionCount() == 0 {
+			m.closeShard(s)
+		}
+	}
+
+	if len(m.shards) < 2 {
+		return
+	}
+
+	sort.Slice(m.shards, func(i, j int) bool {
+		return m.shards[i].client.SubscriptionCount() < m.shards[j].client.SubscriptionCount()
+	})
+	source, targets := m.shards[0], m.shards[1:]
+
+	// Plan the move token by token so every mode of a token lands together
+	byToken := make(map[tokenKey][]int)
+	for mode, lists := range source.client.Subscriptions() {
+		for _, sub := range flatten(mode, lists) {
+			key := tokenKey{sub.exchangeType, sub.token}
+			byToken[key] = append(byToken[key], mode)
+		}
+	}
+
+	free := make(map[*shard]int)
+	for _, t := range targets {
+		free[t] = m.MaxTokensPerConnection - t.client.SubscriptionCount()
+	}
+	plan := make(map[*shard]map[int][]subscription)
+	for key, modes := range byToken {
+		var target *shard
+		for _, t := range targets {
+			if free[t] >= len(modes) && (target == nil || free[t] > free[target]) {
+				target = t
+			}
+		}
+		if target == nil {
+			return
+		}
+		free[target] -= len(modes)
+		if plan[target] == nil {
+			plan[target] = make(map[int][]subscription)
+		}
+		for _, mode := range modes {
+			plan[target][mode] = append(plan[target][mode], subscription{mode, key.exchangeType, key.token})
+		}
+	}
+
+	// Owners move only once every subscribe has succeeded; on failure the
+	// moved tokens are unsubscribed from their targets and stay on source
+	type move struct {
+		target *shard
+		mode   int
+		subs   []subscription
+	}
+	var moved []move
+	for target, byMode := range plan {
+		for mode, subs := range byMode {
+			if err := target.client.Subscribe(mode, groupByExchange(subs)); err != nil {
+				log.Printf("Rebalance failed, keeping connection: %v", err)
+				for _, mv := range moved {
+					if undoErr := mv.target.client.Unsubscribe(mv.mode, groupByExchange(mv.subs)); undoErr != nil {
+						log.Printf("Failed to undo rebalance: %v", undoErr)
+					}
+				}
+				return
+			}
+			moved = append(moved, move{target, mode, subs})
+		}
+	}
+
+	for _, mv := range moved {
+		for _, sub := range mv.subs {
+			m.owners[tokenKey{sub.exchangeType, sub.token}] = mv.target
+		}
+	}
+
+	log.Printf("Rebalanced %d tokens onto %d connections", len(byToken), len(targets))
+	m.closeShard(source)
+}
+
+// leastLoaded returns the connection with the most free capacity, or nil if all are full
+func (m *Manager) leastLoaded(shards []*shard, load func(*shard) int) *shard {
+	var best *shard
+	for _, s := range shards {
+		if load(s) >= m.MaxTokensPerConnection {
+			continue
+		}
+		if best == nil || load(s) < load(best) {
+			best = s
+		}
+	}
+	return best
+}
+
+// newShard creates a connection whose callbacks forward to the manager's
+func (m *Manager) newShard() *shard {
+	client := NewWebSocketClient(m.url, m.headers)
+	client.HeaderFunc = func() map[string]string {
+		if m.HeaderFunc != nil {
+			return m.HeaderFunc()
+		}
+		return m.headers
+	}
+	client.OnTick = func(message []byte) {
+		if m.OnTick != nil {
+			m.OnTick(message)
+		}
+	}
+	client.OnError = func(serverErr *ServerError) {
+		if m.OnError != nil {
+			m.OnError(serverErr)
+		}
+	}
+	client.OnResubscribe = func(tokens int) {
+		if m.OnResubscribe != nil {
+			m.OnResubscribe(tokens)
+		}
+	}
+	client.OnStateChange = func(state State) {
+		if m.OnStateChange != nil {
+			m.OnStateChange(state)
+		}
+	}
+	client.PongTimeout = m.PongTimeout
+	client.CorrelationID = m.CorrelationID
+
+	return &shard{client: client}
+}
+
+// addShard registers a new connection and starts it if Listen is running.
+// Must be called with mu held.
+func (m *Manager) addShard(s *shard) {
+	m.shards = append(m.shards, s)
+	if m.ctx != nil {
+		m.start(s)
+	}
+
+	log.Printf("Opened WebSocket connection %d", len(m.shards))
+}
+
+// start runs a connection under the manager context. Must be called with mu held.
+func (m *Manager) start(s *shard) {
+	if m.stopped || s.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	s.cancel = cancel
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		s.client.Listen(ctx)
+	}()
+}
+
+func (m *Manager) closeShard(s *shard) {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for i, candidate := range m.shards {
+		if candidate == s {
+			m.shards = append(m.shards[:i], m.shards[i+1:]...)
+			break
+		}
+	}
+	for key, owner := range m.owners {
+		if owner == s {
+			delete(m.owners, key)
+		}
+	}
+}
+
+// Connections returns the number of open connections
+func (m *Manager) Connections() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.shards)
+}
+
+// IsConnected reports whether every connection is subscribed
+func (m *Manager) IsConnected() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.shards {
+		if !s.client.IsConnected() {
+			return false
+		}
+	}
+	return len(m.shards) > 0
+}
+
+// LastPongAge returns the oldest pong age across connections
+func (m *Manager) LastPongAge() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var oldest time.Duration
+	for _, s := range m.shards {
+		if age := s.client.LastPongAge(); age > oldest {
+			oldest = age
+		}
+	}
+	return oldest
+}
+
+// LastTick returns the most recent tick across connections
+func (m *Manager) LastTick() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest time.Time
+	for _, s := range m.shards {
+		if tick := s.client.LastTick(); tick.After(latest) {
+			latest = tick
+		}
+	}
+	return latest
+}
+
+func containsMode(modes []int, mode int) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/models"
+)
+
+// newTestManager returns a manager that is not listening, so connections
+// only record their subscriptions
+func newTestManager(maxTokens, maxConnections int) *Manager {
+	m := NewManager("ws://127.0.0.1:1", nil)
+	m.MaxTokensPerConnection = maxTokens
+	m.MaxConnections = maxConnections
+	return m
+}
+
+func (m *Manager) ownerIndex(exchangeType int, token string) int {
+	owner, ok := m.owners[tokenKey{exchangeType, token}]
+	if !ok {
+		return -1
+	}
+	for i, s := range m.shards {
+		if s == owner {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestManagerCapacity(t *testing.T) {
+	m := newTestManager(2, 2)
+
+	err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1", "2", "3", "4", "5")})
+	if !errors.Is(err, ErrCapacityExceeded) {
+		t.Fatalf("got %v, want ErrCapacityExceeded", err)
+	}
+	if m.Connections() != 0 || len(m.owners) != 0 {
+		t.Fatalf("a request that does not fit changed the manager: %d connections, %d owners", m.Connections(), len(m.owners))
+	}
+
+	if err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1", "2", "3", "4")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if m.Connections() != 2 {
+		t.Fatalf("got %d connections, want 2", m.Connections())
+	}
+
+	// A second mode counts against the connection that owns the token
+	err = m.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1")})
+	if !errors.Is(err, ErrCapacityExceeded) {
+		t.Fatalf("got %v, want ErrCapacityExceeded", err)
+	}
+	if modes := m.shards[m.ownerIndex(models.NSE_CM, "1")].client.tokenModes(models.NSE_CM, "1"); len(modes) != 1 {
+		t.Errorf("token 1 has modes %v after a rejected request", modes)
+	}
+}
+
+func TestManagerPlacement(t *testing.T) {
+	m := newTestManager(3, 3)
+
+	if err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1", "2", "2")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := m.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	// Connection 0 is full, so new tokens open a connection and then fill
+	// the least loaded one
+	if err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "3", "4")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	// Already subscribed in LTP, so this changes nothing
+	if err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	want := map[string]int{"1": 0, "2": 0, "3": 1, "4": 1}
+	for token, shard := range want {
+		if got := m.ownerIndex(models.NSE_CM, token); got != shard {
+			t.Errorf("token %s on connection %d, want %d", token, got, shard)
+		}
+	}
+	if got := m.shards[0].client.SubscriptionCount(); got != 3 {
+		t.Errorf("connection 0 has %d subscriptions, want 3", got)
+	}
+	if got := m.shards[0].client.tokenModes(models.NSE_CM, "1"); len(got) != 2 {
+		t.Errorf("token 1 has modes %v, want LTP and Quote on one connection", got)
+	}
+}
+
+func TestManagerFoldsAfterUnsubscribe(t *testing.T) {
+	m := newTestManager(2, 3)
+
+	if err := m.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1", "2", "3")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if m.Connections() != 2 {
+		t.Fatalf("got %d connections, want 2", m.Connections())
+	}
+
+	// Both connections now hold one token, which fits on a single connection
+	if err := m.Unsubscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1")}); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if m.Connections() != 1 {
+		t.Fatalf("got %d connections after folding, want 1", m.Connections())
+	}
+	for _, token := range []string{"2", "3"} {
+		if got := m.ownerIndex(models.NSE_CM, token); got != 0 {
+			t.Errorf("token %s owned by connection %d, want 0", token, got)
+		}
+	}
+	if _, ok := m.owners[tokenKey{models.NSE_CM, "1"}]; ok {
+		t.Error("unsubscribed token still has an owner")
+	}
+	if got := m.shards[0].client.SubscriptionCount(); got != 2 {
+		t.Errorf("remaining connection has %d subscriptions, want 2", got)
+	}
+
+	if err := m.Unsubscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2", "3")}); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if m.Connections() != 0 {
+		t.Errorf("got %d connections with no subscriptions, want 0", m.Connections())
+	}
+}
+
+func TestManagerCallbacksSetAfterSubscribe(t *testing.T) {
+	m := NewManager("ws://127.0.0.1:1", map[string]string{"Authorization": "Bearer initial"})
+	if err := m.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	client := m.shards[0].client
+
+	// Unset callbacks are skipped and the static headers are used
+	client.OnTick([]byte{1})
+	client.OnError(&ServerError{ErrorCode: "E1002"})
+	if got := client.getHttpHeaders().Get("Authorization"); got != "Bearer initial" {
+		t.Errorf("Authorization = %q, want the manager's headers", got)
+	}
+
+	var ticks [][]byte
+	var serverErrors []string
+	m.OnTick = func(message []byte) { ticks = append(ticks, message) }
+	m.OnError = func(serverErr *ServerError) { serverErrors = append(serverErrors, serverErr.ErrorCode) }
+	m.HeaderFunc = func() map[string]string { return map[string]string{"Authorization": "Bearer refreshed"} }
+
+	client.OnTick([]byte{2})
+	client.OnError(&ServerError{ErrorCode: "E1003"})
+	if len(ticks) != 1 || ticks[0][0] != 2 {
+		t.Errorf("OnTick received %v, want the frame sent after it was set", ticks)
+	}
+	if len(serverErrors) != 1 || serverErrors[0] != "E1003" {
+		t.Errorf("OnError received %v, want [E1003]", serverErrors)
+	}
+	if got := client.getHttpHeaders().Get("Authorization"); got != "Bearer refreshed" {
+		t.Errorf("Authorization = %q, want the HeaderFunc value", got)
+	}
+}
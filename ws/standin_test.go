@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/config"
+	"angelone_clickhouse/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestStreamingAgainstLocalStandIn points the configured WebSocket endpoint
+// at a local server and runs subscription and tick delivery through a Manager.
+// Logging in against the REST stand-in is covered in the angel package.
+func TestStreamingAgainstLocalStandIn(t *testing.T) {
+	stream := newTestServer(t)
+	t.Setenv("ANGEL_WS_URL", stream.URL())
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load: %v", err)
+	}
+
+	ticks := make(chan []byte, 1)
+	manager := NewManager(cfg.AngelOne.WebSocketURL, nil)
+	manager.HeaderFunc = func() map[string]string {
+		return map[string]string{"Authorization": "Bearer jwt-1", "X-Feed-Token": "feed-1"}
+	}
+	manager.OnTick = func(frame []byte) { ticks <- frame }
+	if err := manager.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885")}); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.Listen(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	sent := <-stream.headers
+	if got := sent.Get("Authorization"); got != "Bearer jwt-1" {
+		t.Errorf("Authorization = %q, want Bearer jwt-1", got)
+	}
+	if got := sent.Get("X-Feed-Token"); got != "feed-1" {
+		t.Errorf("X-Feed-Token = %q, want feed-1", got)
+	}
+
+	req := readRequest(t, stream)
+	want := angel.SubscriptionParams{Mode: models.LtpMode, TokenList: []angel.TokenSubscription{tokens(models.NSE_CM, "2885")}}
+	if req.Action != models.SubscribeAction || !reflect.DeepEqual(req.Params, want) {
+		t.Errorf("subscription %+v, want subscribe %+v", req, want)
+	}
+
+	frame := []byte{models.LtpMode, models.NSE_CM, '2', '8', '8', '5'}
+	if err := (<-stream.conns).WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatalf("writing tick: %v", err)
+	}
+	select {
+	case got := <-ticks:
+		if !reflect.DeepEqual(got, frame) {
+			t.Errorf("tick = %v, want %v", got, frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tick from the stand-in was not delivered")
+	}
+}
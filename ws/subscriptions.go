@@ -0,0 +1,276 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultCorrelationID is sent with subscription requests unless overridden.
+// SmartStream limits correlation IDs to 10 characters.
+const DefaultCorrelationID = "ws_client"
+
+// subscription is one token subscribed in one mode
+type subscription struct {
+	mode         int
+	exchangeType int
+	token        string
+}
+
+// Subscribe adds tokens to the subscription set in mode. Only tokens not
+// already subscribed in that mode are sent to the server. Before Listen has
+// connected the tokens are only recorded and sent once connected.
+func (c *WebSocketClient) Subscribe(mode int, tokens []angel.TokenSubscription) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	added := c.diff(mode, tokens, false)
+	for _, sub := range added {
+		c.subscriptions[sub] = struct{}{}
+	}
+
+	return c.sendSubscription(models.SubscribeAction, mode, added)
+}
+
+// Unsubscribe removes tokens subscribed in mode. Tokens that are not
+// subscribed in that mode are ignored.
+func (c *WebSocketClient) Unsubscribe(mode int, tokens []angel.TokenSubscription) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	removed := c.diff(mode, tokens, true)
+	for _, sub := range removed {
+		delete(c.subscriptions, sub)
+	}
+
+	return c.sendSubscription(models.UnsubscribeAction, mode, removed)
+}
+
+// ChangeMode moves tokens to mode, unsubscribing them from any other mode
+// they are subscribed in and subscribing them in mode where needed. The set
+// is updated as a whole before any request is sent.
+func (c *WebSocketClient) ChangeMode(mode int, tokens []angel.TokenSubscription) error {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	stale := c.staleModes(mode, tokens)
+	added := c.diff(mode, tokens, false)
+	for _, subs := range stale {
+		for _, sub := range subs {
+			delete(c.subscriptions, sub)
+		}
+	}
+	for _, sub := range added {
+		c.subscriptions[sub] = struct{}{}
+	}
+
+	for _, oldMode := range sortedKeys(stale) {
+		if err := c.sendSubscription(models.UnsubscribeAction, oldMode, stale[oldMode]); err != nil {
+			return err
+		}
+	}
+	return c.sendSubscription(models.SubscribeAction, mode, added)
+}
+
+// staleModes groups the subscriptions of tokens in modes other than mode.
+// Must be called with subMu held.
+func (c *WebSocketClient) staleModes(mode int, tokens []angel.TokenSubscription) map[int][]subscription {
+	wanted := make(map[tokenKey]struct{})
+	for _, sub := range flatten(mode, tokens) {
+		wanted[tokenKey{sub.exchangeType, sub.token}] = struct{}{}
+	}
+
+	stale := make(map[int][]subscription)
+	for sub := range c.subscriptions {
+		if sub.mode == mode {
+			continue
+		}
+		if _, ok := wanted[tokenKey{sub.exchangeType, sub.token}]; ok {
+			stale[sub.mode] = append(stale[sub.mode], sub)
+		}
+	}
+	return stale
+}
+
+// Subscriptions returns the current subscription set grouped by mode
+func (c *WebSocketClient) Subscriptions() map[int][]angel.TokenSubscription {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	byMode := c.subscriptionsByMode()
+	result := make(map[int][]angel.TokenSubscription, len(byMode))
+	for mode, subs := range byMode {
+		result[mode] = groupByExchange(subs)
+	}
+	return result
+}
+
+// diff returns the tokens that are (present true) or are not (present false)
+// already subscribed in mode. Must be called with subMu held.
+func (c *WebSocketClient) diff(mode int, tokens []angel.TokenSubscription, present bool) []subscription {
+	var result []subscription
+	seen := make(map[subscription]struct{})
+	for _, sub := range flatten(mode, tokens) {
+		if _, dup := seen[sub]; dup {
+			continue
+		}
+		seen[sub] = struct{}{}
+
+		if _, ok := c.subscriptions[sub]; ok == present {
+			result = append(result, sub)
+		}
+	}
+	return result
+}
+
+// sendSubscription sends one request for subs if the client is subscribed.
+// The set is already updated: while connecting, or when the connection drops
+// before the request is written, resubscribe replays it on the next
+// connection, so only a shutdown is reported as an error.
+func (c *WebSocketClient) sendSubscription(action, mode int, subs []subscription) error {
+	if len(subs) == 0 || c.State() != StateSubscribed {
+		return nil
+	}
+	err := c.SendJSON(c.subscriptionRequest(action, mode, subs))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrDraining):
+		return err
+	default:
+		log.Printf("Subscription request not sent, replaying on reconnect: %v", err)
+		return nil
+	}
+}
+
+// resubscribe replays the subscription set on a new connection, one request
+// per mode, and moves the client to StateSubscribed. Restored tokens are
+// reported only on reconnects. The callbacks run after subMu is released, so
+// they may call back into the client.
+func (c *WebSocketClient) resubscribe(s *session, reconnect bool) error {
+	tokens, modes, err := c.replay(s)
+	if err != nil {
+		return err
+	}
+	c.notifyState(StateSubscribed)
+
+	if reconnect && tokens > 0 {
+		log.Printf("Restored %d token subscriptions across %d modes", tokens, modes)
+		if c.OnResubscribe != nil {
+			c.OnResubscribe(tokens)
+		}
+	}
+
+	return nil
+}
+
+// replay writes the subscription set to s and enters StateSubscribed without
+// notifying OnStateChange. subMu is held throughout so a concurrent Subscribe
+// either is replayed here or, once subscribed, sends its own request.
+func (c *WebSocketClient) replay(s *session) (tokens, modes int, err error) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	byMode := c.subscriptionsByMode()
+	for _, mode := range sortedKeys(byMode) {
+		data, err := json.Marshal(c.subscriptionRequest(models.SubscribeAction, mode, byMode[mode]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to encode subscription: %v", err)
+		}
+		if err := s.write(websocket.TextMessage, data); err != nil {
+			return 0, 0, fmt.Errorf("failed to restore subscriptions: %v", err)
+		}
+	}
+
+	if !c.state.CompareAndSwap(int32(StateConnecting), int32(StateSubscribed)) {
+		return 0, 0, ErrDraining
+	}
+	return len(c.subscriptions), len(byMode), nil
+}
+
+func (c *WebSocketClient) subscriptionsByMode() map[int][]subscription {
+	byMode := make(map[int][]subscription)
+	for sub := range c.subscriptions {
+		byMode[sub.mode] = append(byMode[sub.mode], sub)
+	}
+	return byMode
+}
+
+func (c *WebSocketClient) subscriptionRequest(action, mode int, subs []subscription) angel.SubscribeRequest {
+	return angel.SubscribeRequest{
+		CorrelationID: c.CorrelationID,
+		Action:        action,
+		Params: angel.SubscriptionParams{
+			Mode:      mode,
+			TokenList: groupByExchange(subs),
+		},
+	}
+}
+
+func flatten(mode int, tokens []angel.TokenSubscription) []subscription {
+	var subs []subscription
+	for _, list := range tokens {
+		for _, token := range list.Tokens {
+			subs = append(subs, subscription{mode: mode, exchangeType: list.ExchangeType, token: token})
+		}
+	}
+	return subs
+}
+
+// groupByExchange builds a token list with one entry per exchange, sorted so
+// requests are deterministic
+func groupByExchange(subs []subscription) []angel.TokenSubscription {
+	byExchange := make(map[int][]string)
+	for _, sub := range subs {
+		byExchange[sub.exchangeType] = append(byExchange[sub.exchangeType], sub.token)
+	}
+
+	tokenList := make([]angel.TokenSubscription, 0, len(byExchange))
+	for _, exchangeType := range sortedKeys(byExchange) {
+		tokens := byExchange[exchangeType]
+		sort.Strings(tokens)
+		tokenList = append(tokenList, angel.TokenSubscription{
+			ExchangeType: exchangeType,
+			Tokens:       tokens,
+		})
+	}
+	return tokenList
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// SubscriptionCount returns the number of token subscriptions across all modes
+func (c *WebSocketClient) SubscriptionCount() int {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	return len(c.subscriptions)
+}
+
+// tokenModes returns the modes a token is subscribed in
+func (c *WebSocketClient) tokenModes(exchangeType int, token string) []int {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	var modes []int
+	for sub := range c.subscriptions {
+		if sub.exchangeType == exchangeType && sub.token == token {
+			modes = append(modes, sub.mode)
+		}
+	}
+	sort.Ints(modes)
+	return modes
+}
@@ -0,0 +1,222 @@
+package ws
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"angelone_clickhouse/angel"
+	"angelone_clickhouse/models"
+)
+
+func tokens(exchangeType int, list ...string) angel.TokenSubscription {
+	return angel.TokenSubscription{ExchangeType: exchangeType, Tokens: list}
+}
+
+// readRequest returns the next subscription request received by the server
+func readRequest(t *testing.T, server *testServer) angel.SubscribeRequest {
+	t.Helper()
+	select {
+	case message := <-server.messages:
+		var req angel.SubscribeRequest
+		if err := json.Unmarshal([]byte(message), &req); err != nil {
+			t.Fatalf("invalid request %q: %v", message, err)
+		}
+		return req
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a subscription request")
+	}
+	return angel.SubscribeRequest{}
+}
+
+func TestDiff(t *testing.T) {
+	client := NewWebSocketClient("", nil)
+	client.subscriptions[subscription{models.QuoteMode, models.NSE_CM, "2885"}] = struct{}{}
+	client.subscriptions[subscription{models.LtpMode, models.NSE_CM, "1594"}] = struct{}{}
+
+	tests := []struct {
+		name    string
+		mode    int
+		tokens  []angel.TokenSubscription
+		present bool
+		want    []subscription
+	}{
+		{
+			name:   "new tokens only, duplicates dropped",
+			mode:   models.QuoteMode,
+			tokens: []angel.TokenSubscription{tokens(models.NSE_CM, "2885", "1594", "1594")},
+			want:   []subscription{{models.QuoteMode, models.NSE_CM, "1594"}},
+		},
+		{
+			name:    "subscribed tokens only",
+			mode:    models.QuoteMode,
+			tokens:  []angel.TokenSubscription{tokens(models.NSE_CM, "2885", "1594")},
+			present: true,
+			want:    []subscription{{models.QuoteMode, models.NSE_CM, "2885"}},
+		},
+		{
+			name:   "same token on another exchange is new",
+			mode:   models.QuoteMode,
+			tokens: []angel.TokenSubscription{tokens(models.BSE_CM, "2885")},
+			want:   []subscription{{models.QuoteMode, models.BSE_CM, "2885"}},
+		},
+		{
+			name:    "nothing subscribed in mode",
+			mode:    models.DepthMode,
+			tokens:  []angel.TokenSubscription{tokens(models.NSE_CM, "2885")},
+			present: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := client.diff(tt.mode, tt.tokens, tt.present)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByExchange(t *testing.T) {
+	tests := []struct {
+		name string
+		subs []subscription
+		want []angel.TokenSubscription
+	}{
+		{
+			name: "empty",
+			want: []angel.TokenSubscription{},
+		},
+		{
+			name: "exchanges and tokens sorted",
+			subs: []subscription{
+				{models.QuoteMode, models.NSE_FO, "43607"},
+				{models.QuoteMode, models.NSE_CM, "2885"},
+				{models.QuoteMode, models.NSE_FO, "35001"},
+				{models.QuoteMode, models.NSE_CM, "1594"},
+			},
+			want: []angel.TokenSubscription{
+				tokens(models.NSE_CM, "1594", "2885"),
+				tokens(models.NSE_FO, "35001", "43607"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := groupByExchange(tt.subs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangeModeGroupsStaleModes(t *testing.T) {
+	server := newTestServer(t)
+	client := NewWebSocketClient(server.URL(), nil)
+	client.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885", "1594")})
+	client.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "11536")})
+	client.Subscribe(models.SnapQuote, []angel.TokenSubscription{tokens(models.NSE_CM, "1594")})
+
+	states := runClient(t, client)
+	waitForState(t, states, StateSubscribed)
+	for i := 0; i < 3; i++ {
+		readRequest(t, server)
+	}
+
+	err := client.ChangeMode(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1594", "2885", "11536")})
+	if err != nil {
+		t.Fatalf("ChangeMode: %v", err)
+	}
+
+	// One unsubscribe per old mode, in mode order, then one subscribe
+	want := []angel.SubscribeRequest{
+		{Action: models.UnsubscribeAction, Params: angel.SubscriptionParams{
+			Mode: models.LtpMode, TokenList: []angel.TokenSubscription{tokens(models.NSE_CM, "1594", "2885")}}},
+		{Action: models.UnsubscribeAction, Params: angel.SubscriptionParams{
+			Mode: models.SnapQuote, TokenList: []angel.TokenSubscription{tokens(models.NSE_CM, "1594")}}},
+		{Action: models.SubscribeAction, Params: angel.SubscriptionParams{
+			Mode: models.QuoteMode, TokenList: []angel.TokenSubscription{tokens(models.NSE_CM, "1594", "2885")}}},
+	}
+	for i, w := range want {
+		got := readRequest(t, server)
+		got.CorrelationID = ""
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("request %d = %+v, want %+v", i, got, w)
+		}
+	}
+
+	wantSet := map[int][]angel.TokenSubscription{
+		models.QuoteMode: {tokens(models.NSE_CM, "11536", "1594", "2885")},
+	}
+	if got := client.Subscriptions(); !reflect.DeepEqual(got, wantSet) {
+		t.Errorf("subscriptions = %v, want %v", got, wantSet)
+	}
+}
+
+func TestChangesDuringReconnectAreReplayed(t *testing.T) {
+	server := newTestServer(t)
+	client := NewWebSocketClient(server.URL(), nil)
+	client.reconnectDelay = 200 * time.Millisecond
+	client.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885")})
+
+	states := runClient(t, client)
+	waitForState(t, states, StateSubscribed)
+	readRequest(t, server)
+
+	(<-server.conns).Close()
+	waitForState(t, states, StateConnecting)
+
+	if err := client.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1594")}); err != nil {
+		t.Fatalf("Subscribe while reconnecting: %v", err)
+	}
+	if err := client.ChangeMode(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885")}); err != nil {
+		t.Fatalf("ChangeMode while reconnecting: %v", err)
+	}
+
+	waitForState(t, states, StateSubscribed)
+	got := readRequest(t, server)
+	want := angel.SubscriptionParams{Mode: models.QuoteMode, TokenList: []angel.TokenSubscription{tokens(models.NSE_CM, "1594", "2885")}}
+	if got.Action != models.SubscribeAction || !reflect.DeepEqual(got.Params, want) {
+		t.Errorf("replayed %+v, want subscribe %+v", got, want)
+	}
+}
+
+func TestResubscribeCallbacksMayCallBackIntoClient(t *testing.T) {
+	server := newTestServer(t)
+
+	client := NewWebSocketClient(server.URL(), nil)
+	client.reconnectDelay = 10 * time.Millisecond
+	client.Subscribe(models.QuoteMode, []angel.TokenSubscription{tokens(models.NSE_CM, "2885")})
+
+	resubscribed := make(chan error, 1)
+	client.OnResubscribe = func(int) {
+		resubscribed <- client.Subscribe(models.LtpMode, []angel.TokenSubscription{tokens(models.NSE_CM, "1594")})
+	}
+	states := runClient(t, client)
+
+	waitForState(t, states, StateSubscribed)
+	readRequest(t, server)
+	(<-server.conns).Close()
+
+	waitForState(t, states, StateSubscribed)
+	if req := readRequest(t, server); req.Params.Mode != models.QuoteMode {
+		t.Fatalf("replayed mode %d, want %d", req.Params.Mode, models.QuoteMode)
+	}
+	select {
+	case err := <-resubscribed:
+		if err != nil {
+			t.Fatalf("Subscribe from OnResubscribe: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Subscribe from OnResubscribe blocked")
+	}
+
+	req := readRequest(t, server)
+	want := []angel.TokenSubscription{tokens(models.NSE_CM, "1594")}
+	if req.Params.Mode != models.LtpMode || !reflect.DeepEqual(req.Params.TokenList, want) {
+		t.Errorf("request from OnResubscribe = %+v, want LTP %v", req.Params, want)
+	}
+}